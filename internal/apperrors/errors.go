@@ -2,4 +2,30 @@ package apperrors
 
 import "errors"
 
-var ErrNotFound = errors.New("not found")
+var (
+	// ErrNotFound is returned if a requested record does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned if an operation clashes with existing state, for example a duplicate name.
+	ErrConflict = errors.New("conflict")
+
+	// ErrInvalid is returned if input is malformed or references something that does not exist.
+	ErrInvalid = errors.New("invalid")
+
+	// ErrForbidden is returned if the caller is not allowed to perform an operation.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrUnavailable is returned if a dependency such as the database is temporarily
+	// unavailable. The operation may succeed if retried later.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// Is reports whether err is, or wraps, any of the app errors.
+func Is(err error) bool {
+	for _, target := range []error{ErrNotFound, ErrConflict, ErrInvalid, ErrForbidden, ErrUnavailable} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
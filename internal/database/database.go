@@ -4,16 +4,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/tombuente/omni/internal/apperrors"
 )
 
-func One[T any](ctx context.Context, pool *pgxpool.Pool, query string, args ...any) (T, error) {
+// maxTxAttempts is the number of times WithTx runs a transaction that keeps
+// failing with a serialization failure or deadlock before giving up.
+const maxTxAttempts = 5
+
+// Querier is satisfied by *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn and pgx.Tx,
+// so that the helpers in this package can be used inside and outside of transactions.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func One[T any](ctx context.Context, q Querier, query string, args ...any) (T, error) {
 	var defaultT T
 
-	rows, err := pool.Query(ctx, query, args...)
+	rows, err := q.Query(ctx, query, args...)
 	if err != nil {
 		return defaultT, translateError(err)
 	}
@@ -26,10 +41,10 @@ func One[T any](ctx context.Context, pool *pgxpool.Pool, query string, args ...a
 	return i, nil
 }
 
-func Many[T any](ctx context.Context, pool *pgxpool.Pool, query string, args ...any) ([]T, error) {
+func Many[T any](ctx context.Context, q Querier, query string, args ...any) ([]T, error) {
 	var defaultT []T
 
-	rows, err := pool.Query(ctx, query, args...)
+	rows, err := q.Query(ctx, query, args...)
 	if err != nil {
 		return defaultT, translateError(err)
 	}
@@ -47,16 +62,118 @@ func Many[T any](ctx context.Context, pool *pgxpool.Pool, query string, args ...
 	return is, nil
 }
 
+// All works like Many but returns an empty slice instead of apperrors.ErrNotFound if there are no rows.
+func All[T any](ctx context.Context, q Querier, query string, args ...any) ([]T, error) {
+	is, err := Many[T](ctx, q, query, args...)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return []T{}, nil
+	}
+	return is, err
+}
+
+// Paginate runs a keyset paginated query and returns up to limit items after cursor.
+// The key of the cursor and the row limit are appended to args, the query must use them
+// to filter and limit rows and order by the same key that key returns, for example:
+//
+//	WHERE (guild_id = $1) AND (id > $2::int8 OR $2 IS NULL) ORDER BY id LIMIT $3
+func Paginate[T any](ctx context.Context, q Querier, query string, cursor Cursor, limit int, key func(T) string, args ...any) (Page[T], error) {
+	after, err := cursor.Key()
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	is, err := All[T](ctx, q, query, append(args, after, limit+1)...)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	return NewPage(is, limit, key), nil
+}
+
+// Exec runs a statement that returns no rows, such as an update or delete,
+// and returns the number of rows affected.
+func Exec(ctx context.Context, q Querier, query string, args ...any) (int64, error) {
+	tag, err := q.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// WithTx runs fn inside a serializable transaction which is committed if fn returns nil
+// and rolled back otherwise. Transactions failing with a serialization failure or
+// deadlock are retried, so fn must not have side effects outside of tx.
+func WithTx(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	opts := pgx.TxOptions{IsoLevel: pgx.Serializable}
+
+	backoff := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := pgx.BeginTxFunc(ctx, pool, opts, fn)
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(err) || attempt == maxTxAttempts {
+			return translateError(err)
+		}
+
+		slog.Debug("Retrying transaction", "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryable reports whether err aborted a transaction that may succeed if run again.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	// serialization_failure, deadlock_detected
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
 // translateError translates a Postgres error into an app error.
-// If err is nil, nil is returned and no translation takes place.
+// If err is nil or already an app error, it is returned and no translation takes place.
 func translateError(err error) error {
-	if err == nil {
-		return nil
+	if err == nil || apperrors.Is(err) {
+		return err
 	}
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return fmt.Errorf("%w: %w", apperrors.ErrNotFound, err)
 	}
 
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return fmt.Errorf("%w: %w", apperrors.ErrConflict, err)
+		case "23503", "23502", "23514": // foreign_key_violation, not_null_violation, check_violation
+			return fmt.Errorf("%w: %w", apperrors.ErrInvalid, err)
+		case "40001", "40P01", "53300", "57P01", "57P03": // serialization_failure, deadlock_detected, too_many_connections, admin_shutdown, cannot_connect_now
+			return fmt.Errorf("%w: %w", apperrors.ErrUnavailable, err)
+		}
+
+		switch pgErr.Code[:2] {
+		case "22": // data_exception
+			return fmt.Errorf("%w: %w", apperrors.ErrInvalid, err)
+		case "08": // connection_exception
+			return fmt.Errorf("%w: %w", apperrors.ErrUnavailable, err)
+		}
+		// Others such as insufficient_privilege are misconfigurations of the database, not of the caller,
+		// and stay internal errors.
+		return err
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return fmt.Errorf("%w: %w", apperrors.ErrUnavailable, err)
+	}
+
 	return err
 }
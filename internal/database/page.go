@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// Cursor points behind the last item of a page. The zero value points to the first page.
+type Cursor string
+
+// Page is one page of a keyset paginated listing.
+type Page[T any] struct {
+	Items []T
+
+	// Next points to the following page, it is empty if this is the last page.
+	Next Cursor
+}
+
+// NewCursor returns a cursor pointing behind the item with the given key.
+func NewCursor(key string) Cursor {
+	return Cursor(base64.RawURLEncoding.EncodeToString([]byte(key)))
+}
+
+// Key returns the key the cursor points behind, NULL for the first page.
+func (c Cursor) Key() (sql.NullString, error) {
+	if c == "" {
+		return sql.NullString{}, nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("malformatted cursor: %w", apperrors.ErrInvalid)
+	}
+	return sql.NullString{String: string(key), Valid: true}, nil
+}
+
+// NewPage cuts is, which holds up to limit+1 items, down to a page and
+// derives the next cursor from the last item of the page.
+func NewPage[T any](is []T, limit int, key func(T) string) Page[T] {
+	if len(is) <= limit {
+		return Page[T]{Items: is}
+	}
+
+	is = is[:limit]
+	return Page[T]{
+		Items: is,
+		Next:  NewCursor(key(is[len(is)-1])),
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	initialListenBackoff = time.Second
+	maxListenBackoff     = 30 * time.Second
+)
+
+// PubSub broadcasts messages between processes sharing a Postgres database using LISTEN/NOTIFY.
+// Handlers must be subscribed before Run is called. Notifications sent while the listening
+// connection is down, or before it first listened, are lost. Reconnect handlers are called every time
+// listening starts, including the first, so that subscribers can resynchronise their state.
+type PubSub struct {
+	pool *pgxpool.Pool
+
+	mu          sync.Mutex
+	handlers    map[string][]func(payload string)
+	onReconnect []func()
+}
+
+func NewPubSub(pool *pgxpool.Pool) *PubSub {
+	return &PubSub{
+		pool:     pool,
+		handlers: make(map[string][]func(payload string)),
+	}
+}
+
+// Subscribe calls handler with the payload of every notification on channel.
+// Handlers are called sequentially from the goroutine running Run.
+func (p *PubSub) Subscribe(channel string, handler func(payload string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers[channel] = append(p.handlers[channel], handler)
+}
+
+// OnReconnect calls fn whenever listening starts, initially and after the connection was lost.
+func (p *PubSub) OnReconnect(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.onReconnect = append(p.onReconnect, fn)
+}
+
+// Publish sends payload to every process listening on channel, including this one.
+func (p *PubSub) Publish(ctx context.Context, channel, payload string) error {
+	const sql = `
+	-- name: publish
+	SELECT pg_notify($1, $2)
+	`
+	_, err := Exec(ctx, p.pool, sql, channel, payload)
+	return err
+}
+
+// Run listens for notifications until ctx is done, reconnecting with exponential backoff if the connection is lost.
+func (p *PubSub) Run(ctx context.Context) error {
+	backoff := initialListenBackoff
+	for attempt := 0; ; attempt++ {
+		listening, err := p.listen(ctx, attempt)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if listening {
+			// The connection worked for a while, start over with a short backoff.
+			backoff = initialListenBackoff
+		}
+
+		slog.Warn("Lost notification listener connection", "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxListenBackoff)
+	}
+}
+
+// listen subscribes a dedicated connection to all channels and dispatches notifications until an error occurs.
+// It reports whether the subscription succeeded. The reconnect handlers are called once subscribed.
+func (p *PubSub) listen(ctx context.Context, attempt int) (bool, error) {
+	poolConn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("unable to acquire connection: %w", err)
+	}
+	// The connection may be broken or still listening, take it out of the pool for good.
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	p.mu.Lock()
+	channels := make([]string, 0, len(p.handlers))
+	for channel := range p.handlers {
+		channels = append(channels, channel)
+	}
+	p.mu.Unlock()
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return false, fmt.Errorf("unable to listen on %q: %w", channel, err)
+		}
+	}
+	if attempt > 0 {
+		slog.Info("Resumed listening for notifications")
+	}
+	// Notifications sent before the subscription, such as while the cache of a subscriber was warmed, are lost.
+	p.reconnected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, translateError(err)
+		}
+
+		p.mu.Lock()
+		handlers := p.handlers[notification.Channel]
+		p.mu.Unlock()
+
+		for _, handle := range handlers {
+			handle(notification.Payload)
+		}
+	}
+}
+
+func (p *PubSub) reconnected() {
+	p.mu.Lock()
+	onReconnect := p.onReconnect
+	p.mu.Unlock()
+
+	for _, fn := range onReconnect {
+		fn()
+	}
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tombuente/omni/internal/apperrors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLQuerier is satisfied by *sql.DB, *sql.Conn and *sql.Tx. It is the database/sql
+// counterpart of Querier, used for drivers other than Postgres such as SQLite.
+type SQLQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// OneSQL works like One for database/sql.
+func OneSQL[T any](ctx context.Context, q SQLQuerier, query string, args ...any) (T, error) {
+	var defaultT T
+
+	is, err := ManySQL[T](ctx, q, query, args...)
+	if err != nil {
+		return defaultT, err
+	}
+	if len(is) > 1 {
+		return defaultT, fmt.Errorf("expected one row, got %v", len(is))
+	}
+
+	return is[0], nil
+}
+
+// ManySQL works like Many for database/sql.
+func ManySQL[T any](ctx context.Context, q SQLQuerier, query string, args ...any) ([]T, error) {
+	var defaultT []T
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return defaultT, translateSQLError(err)
+	}
+	defer rows.Close()
+
+	is, err := collectSQLRows[T](rows)
+	if err != nil {
+		return defaultT, translateSQLError(err)
+	}
+
+	if len(is) == 0 {
+		return defaultT, translateSQLError(sql.ErrNoRows)
+	}
+
+	return is, nil
+}
+
+// AllSQL works like All for database/sql.
+func AllSQL[T any](ctx context.Context, q SQLQuerier, query string, args ...any) ([]T, error) {
+	is, err := ManySQL[T](ctx, q, query, args...)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return []T{}, nil
+	}
+	return is, err
+}
+
+// PaginateSQL works like Paginate for database/sql.
+func PaginateSQL[T any](ctx context.Context, q SQLQuerier, query string, cursor Cursor, limit int, key func(T) string, args ...any) (Page[T], error) {
+	after, err := cursor.Key()
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	is, err := AllSQL[T](ctx, q, query, append(args, after, limit+1)...)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	return NewPage(is, limit, key), nil
+}
+
+// ExecSQL works like Exec for database/sql.
+func ExecSQL(ctx context.Context, q SQLQuerier, query string, args ...any) (int64, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, translateSQLError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, translateSQLError(err)
+	}
+	return n, nil
+}
+
+// WithSQLTx runs fn inside a transaction which is committed if fn returns nil and rolled back otherwise.
+func WithSQLTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return translateSQLError(err)
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	return translateSQLError(tx.Commit())
+}
+
+// WithSQLSavepoint runs fn inside a savepoint of tx, which is released if fn returns nil and rolled back to otherwise.
+func WithSQLSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT sp"); err != nil {
+		return translateSQLError(err)
+	}
+
+	if err := fn(tx); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT sp"); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT sp")
+	return translateSQLError(err)
+}
+
+// collectSQLRows scans every row into a T by matching column names against the db
+// struct tags of T, like pgx.RowToStructByNameLax.
+func collectSQLRows[T any](rows *sql.Rows) ([]T, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var t T
+	typ := reflect.TypeOf(t)
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%v is not a struct", typ)
+	}
+
+	fields := make([]int, len(columns))
+	for i, column := range columns {
+		index, ok := fieldByColumn(typ, column)
+		if !ok {
+			return nil, fmt.Errorf("no field in %v for column %q", typ, column)
+		}
+		fields[i] = index
+	}
+
+	var is []T
+	dest := make([]any, len(columns))
+	for rows.Next() {
+		var i T
+		v := reflect.ValueOf(&i).Elem()
+		for j, index := range fields {
+			dest[j] = v.Field(index).Addr().Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		is = append(is, i)
+	}
+
+	return is, rows.Err()
+}
+
+func fieldByColumn(typ reflect.Type, column string) (int, bool) {
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Tag.Get("db")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if name == column {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// translateSQLError translates a database/sql or SQLite error into an app error.
+// If err is nil or already an app error, it is returned and no translation takes place.
+func translateSQLError(err error) error {
+	if err == nil || apperrors.Is(err) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", apperrors.ErrNotFound, err)
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%w: %w", apperrors.ErrConflict, err)
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY, sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK:
+			return fmt.Errorf("%w: %w", apperrors.ErrInvalid, err)
+		}
+
+		// The lower byte holds the primary result code.
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return fmt.Errorf("%w: %w", apperrors.ErrUnavailable, err)
+		}
+		// Permission errors such as SQLITE_READONLY are misconfigurations of the database file, not of
+		// the caller, and stay internal errors.
+	}
+
+	return err
+}
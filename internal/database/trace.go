@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// latencyBuckets are the upper bounds of the query latency histogram buckets.
+// Queries slower than the last bound are counted in an overflow bucket.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+var queryNameRegexp = regexp.MustCompile(`--\s*name:\s*(\S+)`)
+
+// Tracer is a pgx.QueryTracer that records latency and errors per query and logs slow queries.
+// Queries are identified by a `-- name: <name>` comment, queries without one by their first line.
+type Tracer struct {
+	slowThreshold time.Duration
+
+	mu      sync.Mutex
+	queries map[string]*QueryStats
+}
+
+// QueryStats holds the statistics of one query.
+type QueryStats struct {
+	Count  int64
+	Errors int64
+	Total  time.Duration
+
+	// Buckets counts the queries per latency bucket, the last element counts queries
+	// slower than every bound.
+	Buckets []int64
+}
+
+// PoolStats is a snapshot of the connection pool.
+type PoolStats struct {
+	Total    int32
+	Acquired int32
+	Idle     int32
+	Max      int32
+
+	// EmptyAcquires is the cumulative number of acquires that had to wait for a connection since the pool was
+	// created. It is not logged with the other stats, since it does not tell how many acquires are waiting now.
+	EmptyAcquires int64
+}
+
+type traceKey struct{}
+
+type traceData struct {
+	name  string
+	start time.Time
+}
+
+// NewTracer returns a Tracer that logs queries slower than slowThreshold, zero disables slow query logging.
+func NewTracer(slowThreshold time.Duration) *Tracer {
+	return &Tracer{
+		slowThreshold: slowThreshold,
+		queries:       make(map[string]*QueryStats),
+	}
+}
+
+func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceData{
+		name:  queryName(data.SQL),
+		start: time.Now(),
+	})
+}
+
+func (t *Tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace, ok := ctx.Value(traceKey{}).(traceData)
+	if !ok {
+		return
+	}
+	duration := time.Since(trace.start)
+
+	t.record(trace.name, duration, data.Err)
+
+	if t.slowThreshold > 0 && duration >= t.slowThreshold {
+		slog.Warn("Slow query", "query", trace.name, "duration", duration, "error", data.Err)
+	}
+}
+
+// Stats returns a snapshot of the statistics of every query seen so far.
+func (t *Tracer) Stats() map[string]QueryStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[string]QueryStats, len(t.queries))
+	for name, s := range t.queries {
+		snapshot := *s
+		snapshot.Buckets = append([]int64(nil), s.Buckets...)
+		stats[name] = snapshot
+	}
+	return stats
+}
+
+// LogStats logs the statistics of every query, ordered by name.
+func (t *Tracer) LogStats() {
+	stats := t.Stats()
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := stats[name]
+		slog.Info("Query stats",
+			"query", name,
+			"count", s.Count,
+			"errors", s.Errors,
+			"mean", s.Mean(),
+			"p50", formatQuantile(s.Quantile(0.5)),
+			"p95", formatQuantile(s.Quantile(0.95)),
+			"p99", formatQuantile(s.Quantile(0.99)),
+		)
+	}
+}
+
+// formatQuantile formats a quantile returned by QueryStats.Quantile, quantiles in the overflow bucket as ">= bound".
+func formatQuantile(bound time.Duration, overflow bool) string {
+	if overflow {
+		return ">= " + bound.String()
+	}
+	return bound.String()
+}
+
+func (t *Tracer) record(name string, duration time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.queries[name]
+	if !ok {
+		s = &QueryStats{Buckets: make([]int64, len(latencyBuckets)+1)}
+		t.queries[name] = s
+	}
+
+	s.Count++
+	s.Total += duration
+	if err != nil {
+		s.Errors++
+	}
+	s.Buckets[sort.Search(len(latencyBuckets), func(i int) bool {
+		return duration <= latencyBuckets[i]
+	})]++
+}
+
+// Mean returns the average query latency.
+func (s QueryStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q-quantile, 0 < q <= 1.
+// If the quantile falls into the overflow bucket, it returns the last bound and overflow is set.
+func (s QueryStats) Quantile(q float64) (bound time.Duration, overflow bool) {
+	if s.Count == 0 {
+		return 0, false
+	}
+
+	rank := max(int64(math.Ceil(q*float64(s.Count))), 1)
+	var seen int64
+	for i, n := range s.Buckets {
+		seen += n
+		if seen >= rank && i < len(latencyBuckets) {
+			return latencyBuckets[i], false
+		}
+	}
+	return latencyBuckets[len(latencyBuckets)-1], true
+}
+
+// PoolStatsOf returns a snapshot of the statistics of pool.
+func PoolStatsOf(pool *pgxpool.Pool) PoolStats {
+	stat := pool.Stat()
+	return PoolStats{
+		Total:         stat.TotalConns(),
+		Acquired:      stat.AcquiredConns(),
+		Idle:          stat.IdleConns(),
+		Max:           stat.MaxConns(),
+		EmptyAcquires: stat.EmptyAcquireCount(),
+	}
+}
+
+func (s PoolStats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("total", int(s.Total)),
+		slog.Int("acquired", int(s.Acquired)),
+		slog.Int("idle", int(s.Idle)),
+		slog.Int("max", int(s.Max)),
+	)
+}
+
+// queryName returns the name given by a `-- name:` comment or the first non-empty line of sql.
+func queryName(sql string) string {
+	if match := queryNameRegexp.FindStringSubmatch(sql); match != nil {
+		return match[1]
+	}
+
+	for _, line := range strings.Split(sql, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,276 @@
+package discord
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+const (
+	// activityRenameDelay is how long the activities in a temporary channel may settle before it is renamed.
+	activityRenameDelay = 30 * time.Second
+
+	// activityRenameInterval is the least time between two activity renames of a channel. Discord allows
+	// two renames of a channel per ten minutes, activity renames take at most one of them so that the
+	// owner can still rename the channel.
+	activityRenameInterval = 10 * time.Minute
+)
+
+// activityRenames debounces renaming temporary channels after the activities of their members.
+type activityRenames struct {
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	renamed map[string]time.Time
+
+	// paused holds the channels renamed by their owner, which keep their name until they are deleted.
+	paused map[string]struct{}
+}
+
+func newActivityRenames() *activityRenames {
+	return &activityRenames{
+		timers:  make(map[string]*time.Timer),
+		renamed: make(map[string]time.Time),
+		paused:  make(map[string]struct{}),
+	}
+}
+
+// schedule calls fn once the activities of a channel settled and activityRenameInterval passed since
+// its last rename, unless a call is scheduled already or the channel is paused.
+func (r *activityRenames) schedule(channelID string, fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.paused[channelID]; ok {
+		return
+	}
+	if _, ok := r.timers[channelID]; ok {
+		return
+	}
+
+	delay := activityRenameDelay
+	if renamed, ok := r.renamed[channelID]; ok {
+		delay = max(delay, activityRenameInterval-time.Since(renamed))
+	}
+	r.timers[channelID] = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		delete(r.timers, channelID)
+		r.mu.Unlock()
+
+		fn()
+	})
+}
+
+// done records that a channel was renamed now.
+func (r *activityRenames) done(channelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.renamed[channelID] = time.Now()
+}
+
+// pause stops renaming a channel after activities.
+func (r *activityRenames) pause(channelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stop(channelID)
+	r.paused[channelID] = struct{}{}
+}
+
+func (r *activityRenames) forget(channelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stop(channelID)
+	delete(r.renamed, channelID)
+	delete(r.paused, channelID)
+}
+
+func (r *activityRenames) stopAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for channelID := range r.timers {
+		r.stop(channelID)
+	}
+}
+
+// stop cancels the scheduled rename of a channel, if any. r.mu must be held.
+func (r *activityRenames) stop(channelID string) {
+	if timer, ok := r.timers[channelID]; ok {
+		timer.Stop()
+		delete(r.timers, channelID)
+	}
+}
+
+// presences adds PresenceUpdate event handlers to the session if the presence intent is enabled.
+func (d Discord) presences() {
+	if !d.config.presences {
+		return
+	}
+
+	d.session.AddHandler(func(s *dgo.Session, e *dgo.PresenceUpdate) {
+		if e.User == nil {
+			return
+		}
+		// Presence updates are frequent, only those of members in voice channels are of interest.
+		state, err := s.State.VoiceState(e.GuildID, e.User.ID)
+		if err != nil {
+			return
+		}
+		// The state keeps changing the voice state after the lock was released, the channel is read while it is held.
+		s.State.RLock()
+		channelID := state.ChannelID
+		s.State.RUnlock()
+		if channelID == "" {
+			return
+		}
+
+		// A burst of presence updates would crowd voice state updates out of the event queue of the guild,
+		// scheduling only arms a timer.
+		d.scheduleActivityRename(s, e.GuildID, channelID)
+	})
+}
+
+// scheduleActivityRename renames a temporary channel after the activities of its members soon,
+// if the presence intent is enabled. Other voice channels are ignored once the timer fires.
+func (d Discord) scheduleActivityRename(s *dgo.Session, guildID, channelID string) {
+	if !d.config.presences {
+		return
+	}
+
+	d.activities.schedule(channelID, func() {
+		if err := d.renameAfterActivity(context.Background(), s, guildID, channelID); err != nil {
+			slog.Warn("Unable to rename temporary channel after activity", "guild_id", guildID, "channel", channelID, "error", err)
+		}
+	})
+}
+
+// renameAfterActivity names a temporary channel whose creator channel has activity names enabled after the most
+// common activity of its members, such as "Valorant · 4/5". Once nobody has an activity anymore, or activity
+// names were disabled, the name from before is restored.
+func (d Discord) renameAfterActivity(ctx context.Context, s *dgo.Session, guildID, channelID string) error {
+	ok, err := d.cache.isTemporaryChannel(ctx, guildID, channelID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	channel, err := d.db.temporaryChannel(ctx, channelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get temporary channel: %w", err)
+	}
+	enabled, err := d.activityNames(ctx, channel)
+	if err != nil {
+		return err
+	}
+	discordChannel, err := stateChannel(s, channelID)
+	if err != nil {
+		return err
+	}
+
+	var activity string
+	members := channelMembers(s, guildID, channelID, "")
+	if enabled {
+		activity = commonActivity(s, guildID, members)
+	}
+
+	var name string
+	switch {
+	case activity != "":
+		name = fmt.Sprintf("%v · %v", activity, len(members))
+		if discordChannel.UserLimit > 0 {
+			name = fmt.Sprintf("%v/%v", name, discordChannel.UserLimit)
+		}
+		if runes := []rune(name); len(runes) > maxChannelNameLength {
+			name = string(runes[:maxChannelNameLength])
+		}
+	case channel.BaseName != "":
+		name = channel.BaseName
+	default:
+		return nil
+	}
+
+	if name != discordChannel.Name {
+		if activity != "" && channel.BaseName == "" {
+			// Remember the name to restore before it is gone.
+			if err := d.db.setTemporaryChannelBaseName(ctx, channel.ID, discordChannel.Name); err != nil {
+				return fmt.Errorf("unable to save name of temporary channel (id=%v): %w", channel.ID, err)
+			}
+		}
+		if _, err := s.ChannelEdit(channel.ID, &dgo.ChannelEdit{Name: name}); err != nil {
+			return fmt.Errorf("unable to rename channel: %w", err)
+		}
+		d.activities.done(channel.ID)
+		slog.Info("Renamed temporary channel after activity", "guild_id", guildID, "channel", channel.ID, "activity", activity)
+	}
+
+	if activity == "" {
+		if err := d.db.setTemporaryChannelBaseName(ctx, channel.ID, ""); err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+			return fmt.Errorf("unable to remove name of temporary channel (id=%v): %w", channel.ID, err)
+		}
+	}
+	return nil
+}
+
+// activityNames reports whether the creator channel of a temporary channel has activity names enabled.
+func (d Discord) activityNames(ctx context.Context, channel TemporaryChannel) (bool, error) {
+	if channel.CreatorID == "" {
+		return false, nil
+	}
+
+	creator, err := d.db.creatorChannel(ctx, channel.CreatorID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// The creator channel was deleted since.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get creator channel: %w", err)
+	}
+	return creator.ActivityNames, nil
+}
+
+// commonActivity returns the name of the activity most of userIDs have, such as a game, or an empty string
+// if none of them has one. Custom statuses do not count, ties go to the alphabetically first name.
+func commonActivity(s *dgo.Session, guildID string, userIDs []string) string {
+	counts := make(map[string]int)
+	for _, userID := range userIDs {
+		presence, err := s.State.Presence(guildID, userID)
+		if err != nil {
+			continue
+		}
+
+		s.State.RLock()
+		seen := make(map[string]struct{})
+		for _, activity := range presence.Activities {
+			if activity.Type == dgo.ActivityTypeCustom || activity.Name == "" {
+				continue
+			}
+			if _, ok := seen[activity.Name]; !ok {
+				seen[activity.Name] = struct{}{}
+				counts[activity.Name]++
+			}
+		}
+		s.State.RUnlock()
+	}
+
+	var common string
+	for name, count := range counts {
+		if common == "" || cmp.Or(cmp.Compare(counts[common], count), cmp.Compare(name, common)) < 0 {
+			common = name
+		}
+	}
+	return common
+}
@@ -0,0 +1,297 @@
+package discord
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// defaultCacheMaxGuilds is the number of guilds whose channels are cached if Config.CacheMaxGuilds is unset.
+const defaultCacheMaxGuilds = 1000
+
+// channelCache caches the creator, temporary and waiting room channel IDs of the most recently active guilds,
+// so that voice state updates in ordinary channels do not hit the database. A guild is either
+// cached completely or not at all, hence lookups of cached guilds are authoritative.
+type channelCache struct {
+	db        Storage
+	maxGuilds int
+
+	mu     sync.Mutex
+	guilds map[string]*list.Element // Values are *guildChannels.
+	lru    *list.List               // Front is the most recently used guild.
+
+	// mutations is incremented on every change, a guild loaded from the database
+	// is only cached if no change happened while it was loading.
+	mutations uint64
+
+	hits   uint64
+	misses uint64
+}
+
+type guildChannels struct {
+	guildID           string
+	creatorChannels   map[string]struct{}
+	temporaryChannels map[string]struct{}
+
+	// waitingRooms maps the IDs of waiting rooms to the IDs of their temporary channels.
+	waitingRooms map[string]string
+}
+
+// CacheStats is a snapshot of the channel cache statistics.
+type CacheStats struct {
+	Guilds int
+	Hits   uint64
+	Misses uint64
+}
+
+func newChannelCache(db Storage, maxGuilds int) *channelCache {
+	if maxGuilds <= 0 {
+		maxGuilds = defaultCacheMaxGuilds
+	}
+
+	return &channelCache{
+		db:        db,
+		maxGuilds: maxGuilds,
+		guilds:    make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// warm fills the cache with the channels of as many guilds as fit.
+func (c *channelCache) warm(ctx context.Context) error {
+	c.mu.Lock()
+	mutations := c.mutations
+	c.mu.Unlock()
+
+	creatorChannels, err := c.db.creatorChannels(ctx, creatorChannelFilter{})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to query creator channels: %w", err)
+	}
+	temporaryChannels, err := c.db.temporaryChannels(ctx, temporaryChannelFilter{})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to query temporary channels: %w", err)
+	}
+
+	guilds := make(map[string]*guildChannels)
+	guild := func(guildID string) *guildChannels {
+		g, ok := guilds[guildID]
+		if !ok {
+			g = newGuildChannels(guildID)
+			guilds[guildID] = g
+		}
+		return g
+	}
+	for _, channel := range creatorChannels {
+		guild(channel.GuildID).creatorChannels[channel.ID] = struct{}{}
+	}
+	for _, channel := range temporaryChannels {
+		guild(channel.GuildID).addTemporaryChannel(channel)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mutations != mutations {
+		slog.Info("Channels changed while warming the cache, skipping")
+		return nil
+	}
+	for _, g := range guilds {
+		if len(c.guilds) >= c.maxGuilds {
+			break
+		}
+		c.insert(g)
+	}
+	slog.Info("Warmed channel cache", "guilds", len(c.guilds))
+
+	return nil
+}
+
+func (c *channelCache) isCreatorChannel(ctx context.Context, guildID, channelID string) (bool, error) {
+	return c.lookup(ctx, guildID, func(g *guildChannels) bool {
+		_, ok := g.creatorChannels[channelID]
+		return ok
+	})
+}
+
+func (c *channelCache) isTemporaryChannel(ctx context.Context, guildID, channelID string) (bool, error) {
+	return c.lookup(ctx, guildID, func(g *guildChannels) bool {
+		_, ok := g.temporaryChannels[channelID]
+		return ok
+	})
+}
+
+// waitingRoom returns the ID of the temporary channel whose waiting room channelID is, or an empty string.
+func (c *channelCache) waitingRoom(ctx context.Context, guildID, channelID string) (string, error) {
+	var temporaryChannelID string
+	_, err := c.lookup(ctx, guildID, func(g *guildChannels) bool {
+		temporaryChannelID = g.waitingRooms[channelID]
+		return temporaryChannelID != ""
+	})
+	return temporaryChannelID, err
+}
+
+func (c *channelCache) addCreatorChannel(guildID, channelID string) {
+	c.mutate(guildID, func(g *guildChannels) {
+		g.creatorChannels[channelID] = struct{}{}
+	})
+}
+
+func (c *channelCache) removeCreatorChannel(guildID, channelID string) {
+	c.mutate(guildID, func(g *guildChannels) {
+		delete(g.creatorChannels, channelID)
+	})
+}
+
+func (c *channelCache) addTemporaryChannel(guildID, channelID string) {
+	c.mutate(guildID, func(g *guildChannels) {
+		g.temporaryChannels[channelID] = struct{}{}
+	})
+}
+
+func (c *channelCache) removeTemporaryChannel(guildID, channelID string) {
+	c.mutate(guildID, func(g *guildChannels) {
+		delete(g.temporaryChannels, channelID)
+		maps.DeleteFunc(g.waitingRooms, func(_, temporaryChannelID string) bool {
+			return temporaryChannelID == channelID
+		})
+	})
+}
+
+func (c *channelCache) addWaitingRoom(guildID, channelID, temporaryChannelID string) {
+	c.mutate(guildID, func(g *guildChannels) {
+		g.waitingRooms[channelID] = temporaryChannelID
+	})
+}
+
+func (c *channelCache) removeWaitingRoom(guildID, channelID string) {
+	c.mutate(guildID, func(g *guildChannels) {
+		delete(g.waitingRooms, channelID)
+	})
+}
+
+// invalidate drops a guild from the cache, it is loaded from the database on its next lookup.
+func (c *channelCache) invalidate(guildID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mutations++
+	if e, ok := c.guilds[guildID]; ok {
+		c.lru.Remove(e)
+		delete(c.guilds, guildID)
+	}
+}
+
+// invalidateAll empties the cache.
+func (c *channelCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mutations++
+	clear(c.guilds)
+	c.lru.Init()
+}
+
+func (c *channelCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Guilds: len(c.guilds),
+		Hits:   c.hits,
+		Misses: c.misses,
+	}
+}
+
+// lookup runs fn on the channels of a guild, loading them from the database on a miss.
+func (c *channelCache) lookup(ctx context.Context, guildID string, fn func(g *guildChannels) bool) (bool, error) {
+	c.mu.Lock()
+	if e, ok := c.guilds[guildID]; ok {
+		defer c.mu.Unlock()
+		c.hits++
+		c.lru.MoveToFront(e)
+		return fn(e.Value.(*guildChannels)), nil
+	}
+	c.misses++
+	mutations := c.mutations
+	c.mu.Unlock()
+
+	g, err := c.load(ctx, guildID)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.guilds[guildID]; !ok && c.mutations == mutations {
+		c.insert(g)
+	}
+	return fn(g), nil
+}
+
+func (c *channelCache) load(ctx context.Context, guildID string) (*guildChannels, error) {
+	g := newGuildChannels(guildID)
+	guildFilter := sql.NullString{String: guildID, Valid: true}
+
+	creatorChannels, err := c.db.creatorChannels(ctx, creatorChannelFilter{guildID: guildFilter})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("unable to query creator channels: %w", err)
+	}
+	for _, channel := range creatorChannels {
+		g.creatorChannels[channel.ID] = struct{}{}
+	}
+
+	temporaryChannels, err := c.db.temporaryChannels(ctx, temporaryChannelFilter{guildID: guildFilter})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("unable to query temporary channels: %w", err)
+	}
+	for _, channel := range temporaryChannels {
+		g.addTemporaryChannel(channel)
+	}
+
+	return g, nil
+}
+
+// mutate applies fn to a cached guild. Guilds that are not cached are left alone,
+// they are loaded from the database, which already reflects the change, on their next lookup.
+func (c *channelCache) mutate(guildID string, fn func(g *guildChannels)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mutations++
+	if e, ok := c.guilds[guildID]; ok {
+		fn(e.Value.(*guildChannels))
+	}
+}
+
+// insert adds a guild and evicts the least recently used guild if the cache is full, c.mu must be held.
+func (c *channelCache) insert(g *guildChannels) {
+	c.guilds[g.guildID] = c.lru.PushFront(g)
+
+	for len(c.guilds) > c.maxGuilds {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.guilds, oldest.Value.(*guildChannels).guildID)
+	}
+}
+
+func newGuildChannels(guildID string) *guildChannels {
+	return &guildChannels{
+		guildID:           guildID,
+		creatorChannels:   make(map[string]struct{}),
+		temporaryChannels: make(map[string]struct{}),
+		waitingRooms:      make(map[string]string),
+	}
+}
+
+func (g *guildChannels) addTemporaryChannel(channel TemporaryChannel) {
+	g.temporaryChannels[channel.ID] = struct{}{}
+	if channel.WaitingRoomID != "" {
+		g.waitingRooms[channel.WaitingRoomID] = channel.ID
+	}
+}
@@ -0,0 +1,100 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+)
+
+// changesChannel is the channel on which instances announce changes to each other.
+const changesChannel = "omni_changes"
+
+const (
+	changeCreatorChannelCreated   = "creator_channel_created"
+	changeCreatorChannelDeleted   = "creator_channel_deleted"
+	changeTemporaryChannelCreated = "temporary_channel_created"
+	changeTemporaryChannelDeleted = "temporary_channel_deleted"
+	changeGroupCreated            = "group_created"
+	changeGuildDeleted            = "guild_deleted"
+	changeWaitingRoomChanged      = "waiting_room_changed"
+)
+
+// Broadcaster delivers changes to all omni instances sharing the storage, database.PubSub implements it.
+type Broadcaster interface {
+	Publish(ctx context.Context, channel, payload string) error
+	Subscribe(channel string, handler func(payload string))
+	OnReconnect(fn func())
+}
+
+// change describes a modification of stored state that other instances may have cached.
+type change struct {
+	Origin    string `json:"origin"`
+	Kind      string `json:"kind"`
+	GuildID   string `json:"guild_id"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+// subscribeChanges applies changes announced by other instances to the local state.
+func (d Discord) subscribeChanges() {
+	if d.broadcaster == nil {
+		return
+	}
+
+	d.broadcaster.Subscribe(changesChannel, d.applyChange)
+	d.broadcaster.OnReconnect(func() {
+		// Changes may have been missed before listening or while disconnected.
+		d.cache.invalidateAll()
+	})
+}
+
+// publishChange announces a change to other instances. Failures are logged only,
+// the change itself already succeeded.
+func (d Discord) publishChange(kind, guildID, channelID string) {
+	if d.broadcaster == nil {
+		return
+	}
+
+	payload, err := json.Marshal(change{
+		Origin:    d.instanceID,
+		Kind:      kind,
+		GuildID:   guildID,
+		ChannelID: channelID,
+	})
+	if err != nil {
+		slog.Error("Unable to encode change", "error", err)
+		return
+	}
+
+	if err := d.broadcaster.Publish(context.Background(), changesChannel, string(payload)); err != nil {
+		slog.Warn("Unable to publish change", "kind", kind, "guild_id", guildID, "error", err)
+	}
+}
+
+func (d Discord) applyChange(payload string) {
+	var c change
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		slog.Warn("Received malformatted change", "payload", payload, "error", err)
+		return
+	}
+	if c.Origin == d.instanceID {
+		return
+	}
+
+	switch c.Kind {
+	case changeCreatorChannelCreated:
+		d.cache.addCreatorChannel(c.GuildID, c.ChannelID)
+	case changeCreatorChannelDeleted:
+		d.cache.removeCreatorChannel(c.GuildID, c.ChannelID)
+	case changeTemporaryChannelCreated:
+		d.cache.addTemporaryChannel(c.GuildID, c.ChannelID)
+	case changeTemporaryChannelDeleted:
+		d.cache.removeTemporaryChannel(c.GuildID, c.ChannelID)
+	case changeGroupCreated:
+		// Groups are not kept in memory.
+	case changeGuildDeleted, changeWaitingRoomChanged:
+		d.cache.invalidate(c.GuildID)
+	default:
+		// Unknown changes come from newer instances, drop whatever we know about the guild.
+		d.cache.invalidate(c.GuildID)
+	}
+}
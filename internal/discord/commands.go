@@ -13,6 +13,12 @@ import (
 	"github.com/tombuente/omni/internal/apperrors"
 )
 
+// groupListLimit is the maximum number of groups listed in one message.
+const groupListLimit = 25
+
+// maxChoices is the maximum number of autocomplete choices Discord accepts.
+const maxChoices = 25
+
 var (
 	errNoHandler = errors.New("no handler")
 
@@ -49,41 +55,462 @@ var (
 			},
 		},
 		{
-			Name:        "tempvoice",
+			Name:        "tempvoice-creator",
 			Description: "-",
+			// Hidden from members who cannot manage channels, server admins can override this per role or channel.
+			DefaultMemberPermissions: newInt64(dgo.PermissionManageChannels),
 			Options: []*dgo.ApplicationCommandOption{
 				{
-					Name:         "creator",
-					Description:  "-",
-					Type:         dgo.ApplicationCommandOptionSubCommandGroup,
-					Autocomplete: true,
+					Name:        "create",
+					Description: "Create a creator channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
 					Options: []*dgo.ApplicationCommandOption{
 						{
-							Name:        "create",
-							Description: "Create a creator channel.",
-							Type:        dgo.ApplicationCommandOptionSubCommand,
+							Name:        "name",
+							Description: "Name of the creator channel",
+							Type:        dgo.ApplicationCommandOptionString,
+							MaxLength:   maxChannelNameLength,
+						},
+						{
+							Name:         "category",
+							Description:  "Category to create the creator channel in",
+							Type:         dgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []dgo.ChannelType{dgo.ChannelTypeGuildCategory},
+						},
+						{
+							Name:        "user_limit",
+							Description: "User limit of the creator channel, copied to temporary channels unless set in the settings",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxUserLimit,
+						},
+					},
+				},
+				{
+					Name:        "list",
+					Description: "List the creator channels of this server and their temporary channels.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "adopt",
+					Description: "Turn an existing voice channel into a creator channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The voice channel.",
+							Type:         dgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []dgo.ChannelType{dgo.ChannelTypeGuildVoice},
+							Required:     true,
+						},
+					},
+				},
+				{
+					Name:        "edit",
+					Description: "Rename a creator channel, move it to another category or change its user limit.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "name",
+							Description: "Name of the creator channel",
+							Type:        dgo.ApplicationCommandOptionString,
+							MaxLength:   maxChannelNameLength,
+						},
+						{
+							Name:         "category",
+							Description:  "Category to create the creator channel in",
+							Type:         dgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []dgo.ChannelType{dgo.ChannelTypeGuildCategory},
+						},
+						{
+							Name:        "user_limit",
+							Description: "User limit of the creator channel, copied to temporary channels unless set in the settings",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxUserLimit,
+						},
+					},
+				},
+				{
+					Name:        "delete",
+					Description: "Delete a creator channel, its temporary channels are kept.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "disable",
+					Description: "Stop a creator channel from creating temporary channels.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "enable",
+					Description: "Let a disabled creator channel create temporary channels again.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "position",
+					Description: "Change the position of the creator channel, helps if temporary channels appear in the wrong place.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
 						},
 						{
 							Name:        "position",
-							Description: "Change the position of the creator channel, helps if temporary channels appear in the wrong place.",
-							Type:        dgo.ApplicationCommandOptionSubCommand,
-							Options: []*dgo.ApplicationCommandOption{
-								{
-									Name:         "channel",
-									Description:  "The creator channel.",
-									Type:         dgo.ApplicationCommandOptionString,
-									Required:     true,
-									Autocomplete: true,
-								},
-								{
-									Name:        "position",
-									Description: "New position of the creator channel",
-									Type:        dgo.ApplicationCommandOptionInteger,
-									MinValue:    newIntOption(0),
-									Required:    true,
-								},
+							Description: "New position of the creator channel",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "template",
+					Description: "Show or change how temporary channels of a creator channel are named.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "template",
+							Description: "New template, may contain {username}, {nickname}, {counter}, {creator} and {activity}",
+							Type:        dgo.ApplicationCommandOptionString,
+							MaxLength:   maxChannelNameLength,
+						},
+					},
+				},
+				{
+					Name:        "settings",
+					Description: "Show or change the settings of temporary channels of a creator channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The creator channel.",
+							Type:         dgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "user_limit",
+							Description: "Maximum number of users, 0 for no limit",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxUserLimit,
+						},
+						{
+							Name:        "bitrate",
+							Description: "Bitrate in kbps, the maximum depends on the boost level of the server",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(8),
+							MaxValue:    384,
+						},
+						{
+							Name:        "video_quality",
+							Description: "Camera video quality",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							Choices: []*dgo.ApplicationCommandOptionChoice{
+								{Name: "Auto", Value: videoQualityAuto},
+								{Name: "720p", Value: videoQualityFull},
+							},
+						},
+						{
+							Name:        "region",
+							Description: "Voice region such as rotterdam, or auto",
+							Type:        dgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:         "category",
+							Description:  "Category to create temporary channels in",
+							Type:         dgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []dgo.ChannelType{dgo.ChannelTypeGuildCategory},
+						},
+						{
+							Name:        "nsfw",
+							Description: "Mark temporary channels as age-restricted",
+							Type:        dgo.ApplicationCommandOptionBoolean,
+						},
+						{
+							Name:        "permissions_from",
+							Description: "Channel to copy permissions from instead of the creator channel",
+							Type:        dgo.ApplicationCommandOptionChannel,
+						},
+						{
+							Name:        "roles",
+							Description: "Mentions of the only roles allowed to see and join temporary channels, or none",
+							Type:        dgo.ApplicationCommandOptionString,
+						},
+						{
+							Name:        "delete_delay",
+							Description: "Seconds to keep empty temporary channels before deleting them",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxDeleteDelay,
+						},
+						{
+							Name:        "owner_policy",
+							Description: "Who becomes the owner of a temporary channel when its owner leaves",
+							Type:        dgo.ApplicationCommandOptionString,
+							Choices: []*dgo.ApplicationCommandOptionChoice{
+								{Name: "Member present the longest", Value: ownerPolicyLongest},
+								{Name: "Random member", Value: ownerPolicyRandom},
+								{Name: "Nobody until claimed", Value: ownerPolicyNone},
+							},
+						},
+						{
+							Name:        "activity_names",
+							Description: "Name temporary channels after the most common game or activity of their members",
+							Type:        dgo.ApplicationCommandOptionBoolean,
+						},
+						{
+							Name:        "unset",
+							Description: "Setting to take from the creator channel again, before applying the other options",
+							Type:        dgo.ApplicationCommandOptionString,
+							Choices: []*dgo.ApplicationCommandOptionChoice{
+								{Name: "User limit", Value: "user_limit"},
+								{Name: "Bitrate", Value: "bitrate"},
+								{Name: "Category", Value: "category"},
+								{Name: "Permissions", Value: "permissions_from"},
+							},
+						},
+						{
+							Name:        "reset",
+							Description: "Reset all settings before applying the other options",
+							Type:        dgo.ApplicationCommandOptionBoolean,
+						},
+					},
+				},
+				{
+					Name:        "limits",
+					Description: "Show or change how members of this server may create temporary channels.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "cooldown",
+							Description: "Seconds a member has to wait between creating temporary channels, 0 for none",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxCreateCooldown,
+						},
+						{
+							Name:        "max_owned",
+							Description: "Temporary channels a member may own at once, 0 for no limit",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxGuildChannels,
+						},
+						{
+							Name:        "max_channels",
+							Description: "Temporary channels that may exist in this server at once, 0 for no limit",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxGuildChannels,
+						},
+						{
+							Name:        "action",
+							Description: "What happens to members who hit a limit",
+							Type:        dgo.ApplicationCommandOptionString,
+							Choices: []*dgo.ApplicationCommandOptionChoice{
+								{Name: "Move them to a channel they own", Value: limitActionMove},
+								{Name: "Disconnect them and explain why", Value: limitActionDisconnect},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "tempvoice",
+			Description: "-",
+			Options: []*dgo.ApplicationCommandOption{
+				{
+					Name:        "rename",
+					Description: "Rename your temporary channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "name",
+							Description: "New name of the channel",
+							Type:        dgo.ApplicationCommandOptionString,
+							MaxLength:   100,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "limit",
+					Description: "Limit the number of users in your temporary channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "limit",
+							Description: "Maximum number of users, 0 for no limit",
+							Type:        dgo.ApplicationCommandOptionInteger,
+							MinValue:    newIntOption(0),
+							MaxValue:    maxUserLimit,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "lock",
+					Description: "Prevent users from joining your temporary channel unless permitted.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "unlock",
+					Description: "Allow everyone to join your temporary channel again.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "hide",
+					Description: "Hide your temporary channel from users who are not permitted.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "unhide",
+					Description: "Show your temporary channel to everyone again.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "permit",
+					Description: "Allow a user or role to see and join your temporary channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "target",
+							Description: "User or role",
+							Type:        dgo.ApplicationCommandOptionMentionable,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "reject",
+					Description: "Forbid a user to see and join your temporary channel, and disconnect them.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "User",
+							Type:        dgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "transfer",
+					Description: "Make another user in your temporary channel its owner.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "user",
+							Description: "New owner",
+							Type:        dgo.ApplicationCommandOptionUser,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "claim",
+					Description: "Become the owner of the temporary channel you are in after its owner left.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "reset",
+					Description: "Forget the remembered settings of your temporary channels.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "remember",
+					Description: "Choose whether the settings of your temporary channels are remembered.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "enabled",
+							Description: "Remember settings such as name, user limit and permitted users",
+							Type:        dgo.ApplicationCommandOptionBoolean,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "waitingroom",
+					Description: "Add or remove a waiting room in which members ask to join your temporary channel.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "enabled",
+							Description: "Whether your channel has a waiting room",
+							Type:        dgo.ApplicationCommandOptionBoolean,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "stats",
+					Description: "Show how temporary channels of this server were used.",
+					Type:        dgo.ApplicationCommandOptionSubCommand,
+					Options: []*dgo.ApplicationCommandOption{
+						{
+							Name:        "window",
+							Description: "Time to summarize, defaults to the last week",
+							Type:        dgo.ApplicationCommandOptionString,
+							Choices: []*dgo.ApplicationCommandOptionChoice{
+								{Name: "Last day", Value: "day"},
+								{Name: "Last week", Value: "week"},
+								{Name: "Last month", Value: "month"},
+								{Name: "Last quarter", Value: "quarter"},
 							},
 						},
+						{
+							Name:         "creator",
+							Description:  "Only show temporary channels of this creator channel",
+							Type:         dgo.ApplicationCommandOptionString,
+							Autocomplete: true,
+						},
 					},
 				},
 			},
@@ -109,6 +536,12 @@ type interactionContext struct {
 
 	// If commands are nested, set to options of sub command before calling the handle func.
 	options []*dgo.ApplicationCommandInteractionDataOption
+
+	// For message components and modals, the parts of the custom ID following the handler name.
+	args []string
+
+	// Responses are only shown to the user of the interaction.
+	ephemeral bool
 }
 
 // commands creates slash commands and registers handlers for them.
@@ -130,10 +563,27 @@ func (d Discord) commands() {
 	c := make(map[string]func(s *dgo.Session, i *dgo.InteractionCreate))
 	c["mod"] = wrapInteraction(d.handleMod)
 	c["tempvoice"] = wrapInteraction(d.handleTempVoice)
+	c["tempvoice-creator"] = wrapInteraction(d.handleTempVoiceCreator)
+
+	// Message components and modals are routed by the first part of their custom ID.
+	components := make(map[string]func(s *dgo.Session, i *dgo.InteractionCreate))
+	components[panelCustomID] = wrapInteraction(d.handlePanel)
+	components[knockCustomID] = wrapInteraction(d.handleKnock)
 
 	d.session.AddHandler(func(s *dgo.Session, i *dgo.InteractionCreate) {
-		if handle, ok := c[i.ApplicationCommandData().Name]; ok {
-			handle(s, i)
+		var handle func(s *dgo.Session, i *dgo.InteractionCreate)
+		switch i.Type {
+		case dgo.InteractionApplicationCommand, dgo.InteractionApplicationCommandAutocomplete:
+			handle = c[i.ApplicationCommandData().Name]
+		case dgo.InteractionMessageComponent:
+			name, _ := parseCustomID(i.MessageComponentData().CustomID)
+			handle = components[name]
+		case dgo.InteractionModalSubmit:
+			name, _ := parseCustomID(i.ModalSubmitData().CustomID)
+			handle = components[name]
+		}
+		if handle != nil {
+			go handle(s, i)
 		}
 	})
 }
@@ -169,22 +619,45 @@ func wrapInteraction(handle commandHandleFunc) func(s *dgo.Session, i *dgo.Inter
 			case dgo.InteractionApplicationCommand:
 				slog.Error("command handler failed", "error", err)
 
-				publicMessage := "Internal error"
-				var cmdErr *commandError
-				if errors.As(err, &cmdErr) {
-					publicMessage = cmdErr.publicMessage
-				}
-
-				if err := c.text(publicMessage); err != nil {
+				if err := c.text(publicMessage(err)); err != nil {
 					slog.Warn("Unable to respond to command", "error", err)
 				}
 			case dgo.InteractionApplicationCommandAutocomplete:
 				slog.Error("autocomplete handler failed", "error", err)
+			case dgo.InteractionMessageComponent, dgo.InteractionModalSubmit:
+				slog.Error("component handler failed", "error", err)
+
+				if err := c.text(publicMessage(err)); err != nil {
+					slog.Warn("Unable to respond to component", "error", err)
+				}
 			}
 		}
 	}
 }
 
+// publicMessage returns the message shown to the user for an error returned by a command handler.
+// Handlers can override it by returning a commandError, otherwise it is derived from the app error.
+func publicMessage(err error) string {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.publicMessage
+	}
+
+	switch {
+	case errors.Is(err, apperrors.ErrNotFound):
+		return "Not found."
+	case errors.Is(err, apperrors.ErrConflict):
+		return "This already exists or was changed in the meantime."
+	case errors.Is(err, apperrors.ErrInvalid):
+		return "Invalid input."
+	case errors.Is(err, apperrors.ErrForbidden):
+		return "You are not allowed to do this."
+	case errors.Is(err, apperrors.ErrUnavailable):
+		return "Temporarily unavailable, please try again later."
+	}
+	return "Internal error"
+}
+
 func withAutocomplete(c *interactionContext, handleCommand commandHandleFunc, handleAutocomplete autocompleteHandleFunc) error {
 	switch c.i.Type {
 	case dgo.InteractionApplicationCommand:
@@ -221,20 +694,70 @@ func (d Discord) handleTempVoice(c *interactionContext) error {
 	name := c.options[0].Name
 	c.options = c.options[0].Options
 	switch name {
-	case "creator":
-		return d.handleTempVoiceCreator(c)
+	case "rename":
+		return d.handleTempVoiceRename(c)
+	case "limit":
+		return d.handleTempVoiceLimit(c)
+	case "lock":
+		return d.handleTempVoiceOverwrite(c, overwriteChange{deny: dgo.PermissionVoiceConnect}, func(p *UserPreferences) { p.Locked = true }, "Locked the channel.")
+	case "unlock":
+		return d.handleTempVoiceOverwrite(c, overwriteChange{inherit: dgo.PermissionVoiceConnect}, func(p *UserPreferences) { p.Locked = false }, "Unlocked the channel.")
+	case "hide":
+		return d.handleTempVoiceOverwrite(c, overwriteChange{deny: dgo.PermissionViewChannel}, func(p *UserPreferences) { p.Hidden = true }, "Hid the channel.")
+	case "unhide":
+		return d.handleTempVoiceOverwrite(c, overwriteChange{inherit: dgo.PermissionViewChannel}, func(p *UserPreferences) { p.Hidden = false }, "The channel is visible again.")
+	case "permit":
+		return d.handleTempVoicePermit(c)
+	case "reject":
+		return d.handleTempVoiceReject(c)
+	case "transfer":
+		return d.handleTempVoiceTransfer(c)
+	case "claim":
+		return d.handleTempVoiceClaim(c)
+	case "reset":
+		return d.handleTempVoiceReset(c)
+	case "remember":
+		return d.handleTempVoiceRemember(c)
+	case "waitingroom":
+		return d.handleTempVoiceWaitingRoom(c)
+	case "stats":
+		return withAutocomplete(c, d.handleTempVoiceStats, d.handleCreatorChannelAutocomplete)
 	}
 	return errNoHandler
 }
 
+// handleTempVoiceCreator handles the admin commands about creator channels. Discord only shows them to members
+// with the Manage Channels permission by default, they are checked again in case the command permissions were changed.
 func (d Discord) handleTempVoiceCreator(c *interactionContext) error {
+	if c.i.Member == nil || c.i.Member.Permissions&dgo.PermissionManageChannels == 0 {
+		return newCommandError("You need the Manage Channels permission to manage creator channels.").WithErr(apperrors.ErrForbidden)
+	}
+
 	name := c.options[0].Name
 	c.options = c.options[0].Options
 	switch name {
 	case "create":
 		return d.handleTempVoiceCreatorCreate(c)
+	case "list":
+		return d.handleTempVoiceCreatorList(c)
+	case "adopt":
+		return d.handleTempVoiceCreatorAdopt(c)
+	case "edit":
+		return withAutocomplete(c, d.handleTempVoiceCreatorEdit, d.handleCreatorChannelAutocomplete)
+	case "delete":
+		return withAutocomplete(c, d.handleTempVoiceCreatorDelete, d.handleCreatorChannelAutocomplete)
+	case "disable":
+		return withAutocomplete(c, func(c *interactionContext) error { return d.handleTempVoiceCreatorEnable(c, false) }, d.handleCreatorChannelAutocomplete)
+	case "enable":
+		return withAutocomplete(c, func(c *interactionContext) error { return d.handleTempVoiceCreatorEnable(c, true) }, d.handleCreatorChannelAutocomplete)
 	case "position":
-		return withAutocomplete(c, d.handleTempVoiceCreatorPosition, d.handleTempVoiceCreatorPositionAutocomplete)
+		return withAutocomplete(c, d.handleTempVoiceCreatorPosition, d.handleCreatorChannelAutocomplete)
+	case "template":
+		return withAutocomplete(c, d.handleTempVoiceCreatorTemplate, d.handleCreatorChannelAutocomplete)
+	case "settings":
+		return withAutocomplete(c, d.handleTempVoiceCreatorSettings, d.handleCreatorChannelAutocomplete)
+	case "limits":
+		return d.handleTempVoiceCreatorLimits(c)
 	}
 	return errNoHandler
 }
@@ -247,16 +770,17 @@ func (d Discord) handleModGroupList(c *interactionContext) error {
 	filter := GroupFilter{
 		guildID: sql.NullString{String: c.i.GuildID, Valid: true},
 	}
-	groups, err := d.db.groups(context.Background(), filter)
-	if errors.Is(err, apperrors.ErrNotFound) {
-		return c.text("No groups found.")
-	} else if err != nil {
+	page, err := d.db.groupsPage(context.Background(), filter, "", groupListLimit)
+	if err != nil {
 		return fmt.Errorf("unable to get groups: %w", err)
 	}
+	if len(page.Items) == 0 {
+		return c.text("No groups found.")
+	}
 
 	var message string
 	nameCache := make(map[string]string)
-	for i, g := range groups {
+	for i, g := range page.Items {
 		name, ok := nameCache[g.GuildID]
 		if !ok {
 			group, err := d.session.Guild(g.GuildID)
@@ -269,6 +793,9 @@ func (d Discord) handleModGroupList(c *interactionContext) error {
 
 		message += fmt.Sprintf("%v. `%v` (%v)\n", i, g.Name, name)
 	}
+	if page.Next != "" {
+		message += "…and more."
+	}
 
 	return c.text(message)
 }
@@ -286,31 +813,46 @@ func (d Discord) handleModGroupCreate(c *interactionContext) error {
 		guildID: c.i.GuildID,
 	}
 	_, err := d.db.createGroup(context.Background(), params)
+	if errors.Is(err, apperrors.ErrConflict) {
+		return newCommandError(fmt.Sprintf("A group named `%v` already exists.", name)).WithErr(err)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to create group %q: %w", name, err)
 	}
+	d.publishChange(changeGroupCreated, c.i.GuildID, "")
 
 	return c.text(fmt.Sprintf("Created group `%v`", name))
 }
 
 func (d Discord) handleTempVoiceCreatorCreate(c *interactionContext) error {
+	options := c.optionMap()
+
 	data := dgo.GuildChannelCreateData{
 		Name: "Creator",
 		Type: dgo.ChannelTypeGuildVoice,
 	}
+	if option, ok := options["name"]; ok {
+		data.Name = option.StringValue()
+	}
+	if option, ok := options["category"]; ok {
+		data.ParentID = option.Value.(string)
+	}
+	if option, ok := options["user_limit"]; ok {
+		data.UserLimit = int(option.IntValue())
+	}
 	channel, err := c.s.GuildChannelCreateComplex(c.i.GuildID, data)
 	if err != nil {
 		return newCommandError("Unable to create guild channel").WithErr(err)
 	}
 
-	if _, err := d.db.createCreatorChannel(context.Background(), CreatorChannel{ID: channel.ID, GuildID: channel.GuildID}); err != nil {
+	if err := d.trackCreatorChannel(context.Background(), channel); err != nil {
 		if _, delErr := c.s.ChannelDelete(channel.ID); delErr != nil {
-			slog.Warn("Unable to delete creator channel that is not tracked in the database", slog.Group("error", err.Error(), delErr))
+			slog.Warn("Unable to delete creator channel that is not tracked in the database", "channel", channel.ID, "error", delErr)
 		}
 		return err
 	}
 
-	return c.text(fmt.Sprintf("Created creator channel `%v`, feel free to move it!", channel.ID))
+	return c.text(fmt.Sprintf("Created creator channel <#%v>, feel free to move it!", channel.ID))
 }
 
 func (d Discord) handleTempVoiceCreatorPosition(c *interactionContext) error {
@@ -327,8 +869,46 @@ func (d Discord) handleTempVoiceCreatorPosition(c *interactionContext) error {
 	return c.text("Updated channel")
 }
 
-func (d Discord) handleTempVoiceCreatorPositionAutocomplete(c *interactionContext) error {
-	channels, err := d.db.creatorChannels(context.Background(), creatorChannelFilter{guildID: c.i.GuildID})
+func (d Discord) handleTempVoiceCreatorTemplate(c *interactionContext) error {
+	options := c.optionMap()
+	channelID := options["channel"].StringValue() // required
+
+	ctx := context.Background()
+	creator, err := d.db.creatorChannel(ctx, channelID)
+	if err != nil {
+		return fmt.Errorf("unable to get creator channel: %w", err)
+	}
+	if creator.GuildID != c.i.GuildID {
+		return fmt.Errorf("creator channel belongs to another guild: %w", apperrors.ErrNotFound)
+	}
+
+	message := "Template"
+	if option, ok := options["template"]; ok {
+		creator.NameTemplate = strings.TrimSpace(option.StringValue())
+		if creator, err = d.db.updateCreatorChannel(ctx, creator); err != nil {
+			return fmt.Errorf("unable to update creator channel: %w", err)
+		}
+		message = "Changed template"
+	}
+	if creator.NameTemplate == "" {
+		creator.NameTemplate = defaultNameTemplate
+	}
+
+	channel, err := c.s.Channel(creator.ID)
+	if err != nil {
+		return newCommandError("Unable to get creator channel").WithErr(err)
+	}
+	number, err := d.nextNumber(ctx, creator.ID)
+	if err != nil {
+		return err
+	}
+	preview := renderName(creator.NameTemplate, newNameData(c.s, c.i.Member, channel, number))
+
+	return c.text(fmt.Sprintf("%v of <#%v>: `%v`\nYour next channel would be named `%v`.", message, creator.ID, creator.NameTemplate, preview))
+}
+
+func (d Discord) handleCreatorChannelAutocomplete(c *interactionContext) error {
+	channels, err := d.db.creatorChannels(context.Background(), creatorChannelFilter{guildID: sql.NullString{String: c.i.GuildID, Valid: true}})
 	if errors.Is(err, apperrors.ErrNotFound) {
 		return c.choices([]*dgo.ApplicationCommandOptionChoice{})
 	}
@@ -345,17 +925,33 @@ func (d Discord) handleTempVoiceCreatorPositionAutocomplete(c *interactionContex
 		names[channel.ID] = channel.Name
 	}
 
-	var choices []*dgo.ApplicationCommandOptionChoice
+	var typed string
+	for _, option := range c.options {
+		if option.Focused {
+			typed = strings.ToLower(option.StringValue())
+		}
+	}
+
+	choices := []*dgo.ApplicationCommandOptionChoice{}
 	for _, channel := range channels {
 		name, ok := names[channel.ID]
 		if !ok {
 			slog.Warn("Channel does not exist anymore", "channel", channel.ID)
 			continue
 		}
+		if !strings.Contains(strings.ToLower(name), typed) {
+			continue
+		}
+		if channel.Disabled {
+			name += " (disabled)"
+		}
 		choices = append(choices, &dgo.ApplicationCommandOptionChoice{
 			Name:  name,
 			Value: channel.ID,
 		})
+		if len(choices) == maxChoices {
+			break
+		}
 	}
 
 	return c.choices(choices)
@@ -386,11 +982,33 @@ func (e *commandError) Unwrap() error {
 }
 
 func newCommandContext(s *dgo.Session, i *dgo.InteractionCreate) *interactionContext {
-	return &interactionContext{
-		s:       s,
-		i:       i,
-		options: i.ApplicationCommandData().Options,
+	c := &interactionContext{
+		s: s,
+		i: i,
+	}
+
+	switch i.Type {
+	case dgo.InteractionApplicationCommand, dgo.InteractionApplicationCommandAutocomplete:
+		c.options = i.ApplicationCommandData().Options
+	case dgo.InteractionMessageComponent:
+		_, c.args = parseCustomID(i.MessageComponentData().CustomID)
+		c.ephemeral = true
+	case dgo.InteractionModalSubmit:
+		_, c.args = parseCustomID(i.ModalSubmitData().CustomID)
+		c.ephemeral = true
 	}
+	return c
+}
+
+// customID builds the custom ID of a message component or modal. The first part
+// is the name of the handler, the others are passed to it as arguments.
+func customID(parts ...string) string {
+	return strings.Join(parts, ":")
+}
+
+func parseCustomID(id string) (string, []string) {
+	parts := strings.Split(id, ":")
+	return parts[0], parts[1:]
 }
 
 func (c *interactionContext) optionMap() map[string]*dgo.ApplicationCommandInteractionDataOption {
@@ -401,12 +1019,21 @@ func (c *interactionContext) optionMap() map[string]*dgo.ApplicationCommandInter
 	return m
 }
 
+// userID returns the ID of the user who caused the interaction.
+func (c *interactionContext) userID() string {
+	if c.i.Member != nil {
+		return c.i.Member.User.ID
+	}
+	return c.i.User.ID
+}
+
 func (c *interactionContext) text(msg string) error {
 	if !c.deferred {
 		if err := c.s.InteractionRespond(c.i.Interaction, &dgo.InteractionResponse{
 			Type: dgo.InteractionResponseChannelMessageWithSource,
 			Data: &dgo.InteractionResponseData{
 				Content: msg,
+				Flags:   c.flags(),
 			},
 		}); err != nil {
 			return err
@@ -428,9 +1055,59 @@ func (c *interactionContext) choices(choices []*dgo.ApplicationCommandOptionChoi
 	})
 }
 
+// components responds with a message holding components, such as a select menu asking for input.
+func (c *interactionContext) components(msg string, components ...dgo.MessageComponent) error {
+	return c.s.InteractionRespond(c.i.Interaction, &dgo.InteractionResponse{
+		Type: dgo.InteractionResponseChannelMessageWithSource,
+		Data: &dgo.InteractionResponseData{
+			Content:    msg,
+			Components: components,
+			Flags:      c.flags(),
+		},
+	})
+}
+
+// modal responds with a modal, whose submission is a new interaction.
+func (c *interactionContext) modal(customID, title string, components ...dgo.MessageComponent) error {
+	return c.s.InteractionRespond(c.i.Interaction, &dgo.InteractionResponse{
+		Type: dgo.InteractionResponseModal,
+		Data: &dgo.InteractionResponseData{
+			CustomID:   customID,
+			Title:      title,
+			Components: components,
+		},
+	})
+}
+
+// modalValue returns the value of a text input of a submitted modal.
+func (c *interactionContext) modalValue(customID string) string {
+	for _, row := range c.i.ModalSubmitData().Components {
+		row, ok := row.(*dgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range row.Components {
+			if input, ok := component.(*dgo.TextInput); ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (c *interactionContext) flags() dgo.MessageFlags {
+	if c.ephemeral {
+		return dgo.MessageFlagsEphemeral
+	}
+	return 0
+}
+
 func (c *interactionContext) deferCmd() error {
 	if err := c.s.InteractionRespond(c.i.Interaction, &dgo.InteractionResponse{
 		Type: dgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &dgo.InteractionResponseData{
+			Flags: c.flags(),
+		},
 	}); err != nil {
 		return fmt.Errorf("unable to defer interaction: %w", err)
 	}
@@ -446,3 +1123,7 @@ func newIntOption(value int) *float64 {
 func newInt(value int) *int {
 	return &value
 }
+
+func newInt64(value int64) *int64 {
+	return &value
+}
@@ -0,0 +1,53 @@
+package discord
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+func TestCreatorCommandsRequireManageChannels(t *testing.T) {
+	i := slices.IndexFunc(commands, func(cmd *dgo.ApplicationCommand) bool { return cmd.Name == "tempvoice-creator" })
+	if i == -1 {
+		t.Fatal("/tempvoice-creator is not defined")
+	}
+	creator := commands[i]
+	if creator.DefaultMemberPermissions == nil || *creator.DefaultMemberPermissions != dgo.PermissionManageChannels {
+		t.Fatalf("/tempvoice-creator does not require Manage Channels by default")
+	}
+
+	tests := []string{
+		"create",
+		"adopt",
+		"edit",
+		"delete",
+		"disable",
+		"enable",
+		"settings",
+		"limits",
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !slices.ContainsFunc(creator.Options, func(option *dgo.ApplicationCommandOption) bool { return option.Name == name }) {
+				t.Fatalf("%v is not a subcommand of /tempvoice-creator", name)
+			}
+
+			i := &dgo.InteractionCreate{Interaction: &dgo.Interaction{
+				Type:   dgo.InteractionApplicationCommand,
+				Member: &dgo.Member{Permissions: dgo.PermissionVoiceConnect},
+				Data: dgo.ApplicationCommandInteractionData{
+					Name: creator.Name,
+					Options: []*dgo.ApplicationCommandInteractionDataOption{
+						{Name: name, Type: dgo.ApplicationCommandOptionSubCommand},
+					},
+				},
+			}}
+			if err := (Discord{}).handleTempVoiceCreator(newCommandContext(nil, i)); !errors.Is(err, apperrors.ErrForbidden) {
+				t.Fatalf("got %v, want ErrForbidden", err)
+			}
+		})
+	}
+}
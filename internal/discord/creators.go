@@ -0,0 +1,198 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// trackCreatorChannel stores a voice channel as creator channel with default settings and tells other instances.
+func (d Discord) trackCreatorChannel(ctx context.Context, channel *dgo.Channel) error {
+	params := CreatorChannel{
+		ID:           channel.ID,
+		GuildID:      channel.GuildID,
+		NameTemplate: defaultNameTemplate,
+		OwnerPolicy:  ownerPolicyLongest,
+	}
+	if _, err := d.db.createCreatorChannel(ctx, params); err != nil {
+		return fmt.Errorf("unable to create creator channel (id=%v): %w", channel.ID, err)
+	}
+	d.cache.addCreatorChannel(channel.GuildID, channel.ID)
+	d.publishChange(changeCreatorChannelCreated, channel.GuildID, channel.ID)
+
+	return nil
+}
+
+// guildCreatorChannel returns a creator channel of a guild.
+func (d Discord) guildCreatorChannel(ctx context.Context, guildID, channelID string) (CreatorChannel, error) {
+	creator, err := d.db.creatorChannel(ctx, channelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return CreatorChannel{}, newCommandError("This is not a creator channel.").WithErr(err)
+	}
+	if err != nil {
+		return CreatorChannel{}, fmt.Errorf("unable to get creator channel: %w", err)
+	}
+	if creator.GuildID != guildID {
+		return CreatorChannel{}, fmt.Errorf("creator channel belongs to another guild: %w", apperrors.ErrNotFound)
+	}
+	return creator, nil
+}
+
+func (d Discord) handleTempVoiceCreatorList(c *interactionContext) error {
+	ctx := context.Background()
+	guildFilter := sql.NullString{String: c.i.GuildID, Valid: true}
+
+	creators, err := d.db.creatorChannels(ctx, creatorChannelFilter{guildID: guildFilter})
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return c.text("There are no creator channels yet, use `/tempvoice-creator create` or `/tempvoice-creator adopt`.")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to query creator channels: %w", err)
+	}
+	temporaryChannels, err := d.db.temporaryChannels(ctx, temporaryChannelFilter{guildID: guildFilter})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to query temporary channels: %w", err)
+	}
+	guild, err := snapshotGuild(c.s, c.i.GuildID)
+	if err != nil {
+		return err
+	}
+
+	channels := make(map[string]int)
+	members := make(map[string]int)
+	for _, channel := range temporaryChannels {
+		channels[channel.CreatorID]++
+		members[channel.CreatorID] += len(guild.voiceStates[channel.ID])
+	}
+
+	var b strings.Builder
+	b.WriteString("Creator channels:\n")
+	for _, creator := range creators {
+		b.WriteString(fmt.Sprintf("- <#%v>: %v temporary channels, %v members", creator.ID, channels[creator.ID], members[creator.ID]))
+		if creator.Disabled {
+			b.WriteString(" (disabled)")
+		}
+		b.WriteString("\n")
+	}
+
+	return c.text(b.String())
+}
+
+func (d Discord) handleTempVoiceCreatorAdopt(c *interactionContext) error {
+	channelID := c.optionMap()["channel"].Value.(string) // required
+
+	ctx := context.Background()
+	ok, err := d.cache.isCreatorChannel(ctx, c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return newCommandError("This is a creator channel already.")
+	}
+	ok, err = d.cache.isTemporaryChannel(ctx, c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return newCommandError("Temporary channels cannot become creator channels.")
+	}
+	temporaryChannelID, err := d.cache.waitingRoom(ctx, c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+	if temporaryChannelID != "" {
+		return newCommandError("Waiting rooms cannot become creator channels.")
+	}
+
+	channel, err := stateChannel(c.s, channelID)
+	if err != nil {
+		return newCommandError("Unable to get channel").WithErr(err)
+	}
+	if channel.Type != dgo.ChannelTypeGuildVoice {
+		return newCommandError("Only voice channels can become creator channels.")
+	}
+	if err := d.trackCreatorChannel(ctx, channel); err != nil {
+		return err
+	}
+
+	return c.text(fmt.Sprintf("<#%v> is a creator channel now.", channel.ID))
+}
+
+func (d Discord) handleTempVoiceCreatorEdit(c *interactionContext) error {
+	options := c.optionMap()
+	channelID := options["channel"].StringValue() // required
+
+	creator, err := d.guildCreatorChannel(context.Background(), c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+	if len(options) == 1 {
+		return newCommandError("Choose what to change.")
+	}
+
+	edit := &dgo.ChannelEdit{}
+	if option, ok := options["name"]; ok {
+		edit.Name = option.StringValue()
+	}
+	if option, ok := options["category"]; ok {
+		edit.ParentID = option.Value.(string)
+	}
+	if edit.Name != "" || edit.ParentID != "" {
+		if _, err := c.s.ChannelEdit(creator.ID, edit); err != nil {
+			return newCommandError("Unable to edit channel").WithErr(err)
+		}
+	}
+	if option, ok := options["user_limit"]; ok {
+		if err := setUserLimit(c.s, creator.ID, int(option.IntValue())); err != nil {
+			return newCommandError("Unable to change the user limit").WithErr(err)
+		}
+	}
+
+	return c.text(fmt.Sprintf("Updated <#%v>.", creator.ID))
+}
+
+// handleTempVoiceCreatorDelete deletes the Discord channel of a creator channel and then its row, so that the
+// creator channel is kept as it was if Discord refuses. The ChannelDelete event forgets it as well.
+func (d Discord) handleTempVoiceCreatorDelete(c *interactionContext) error {
+	channelID := c.optionMap()["channel"].StringValue() // required
+
+	ctx := context.Background()
+	creator, err := d.guildCreatorChannel(ctx, c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.s.ChannelDelete(creator.ID); err != nil {
+		return newCommandError("Unable to delete channel").WithErr(err)
+	}
+	if err := d.forgetCreatorChannel(ctx, creator.GuildID, creator.ID); err != nil {
+		return err
+	}
+
+	return c.text("Deleted the creator channel, its temporary channels are kept until they are empty.")
+}
+
+func (d Discord) handleTempVoiceCreatorEnable(c *interactionContext, enabled bool) error {
+	channelID := c.optionMap()["channel"].StringValue() // required
+
+	ctx := context.Background()
+	creator, err := d.guildCreatorChannel(ctx, c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+
+	creator.Disabled = !enabled
+	if _, err := d.db.updateCreatorChannel(ctx, creator); err != nil {
+		return fmt.Errorf("unable to update creator channel: %w", err)
+	}
+
+	if enabled {
+		return c.text(fmt.Sprintf("<#%v> creates temporary channels again.", creator.ID))
+	}
+	return c.text(fmt.Sprintf("<#%v> does not create temporary channels anymore.", creator.ID))
+}
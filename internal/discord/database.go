@@ -2,110 +2,499 @@ package discord
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/tombuente/omni/internal/database"
 )
 
+// Database is the Postgres backed Storage.
 type Database struct {
 	pool *pgxpool.Pool
+
+	// q is the pool, or the transaction if the Database was obtained through withTx.
+	q database.Querier
 }
 
 func MakeDatabase(pool *pgxpool.Pool) Database {
 	return Database{
 		pool: pool,
+		q:    pool,
+	}
+}
+
+// withTx runs fn with a Database whose queries all run in one transaction.
+// Calling withTx on a transactional Database creates a savepoint.
+func (db Database) withTx(ctx context.Context, fn func(tx Storage) error) error {
+	wrap := func(tx pgx.Tx) error {
+		return fn(Database{pool: db.pool, q: tx})
+	}
+
+	if tx, ok := db.q.(pgx.Tx); ok {
+		return pgx.BeginFunc(ctx, tx, wrap)
 	}
+	return database.WithTx(ctx, db.pool, wrap)
+}
+
+func (db Database) ensureGuild(ctx context.Context, id string) error {
+	const sql = `
+	-- name: ensureGuild
+	INSERT INTO
+		discord.guilds (id)
+	VALUES
+		($1::int8)
+	ON CONFLICT DO NOTHING
+	`
+	_, err := database.Exec(ctx, db.q, sql, id)
+	return err
+}
+
+func (db Database) deleteGuild(ctx context.Context, id string) error {
+	const sql = `
+	-- name: deleteGuild
+	WITH
+		creator_channels AS (DELETE FROM discord.creator_channels WHERE guild_id = $1::int8),
+		temporary_channels AS (DELETE FROM discord.temporary_channels WHERE guild_id = $1::int8),
+		groups AS (DELETE FROM discord.groups WHERE guild_id = $1::int8),
+		user_preferences AS (DELETE FROM discord.user_preferences WHERE guild_id = $1::int8),
+		channel_sessions AS (DELETE FROM discord.channel_sessions WHERE guild_id = $1::int8),
+		member_sessions AS (DELETE FROM discord.member_sessions WHERE guild_id = $1::int8)
+	DELETE FROM
+		discord.guilds
+	WHERE
+		id = $1::int8
+	`
+	_, err := database.Exec(ctx, db.q, sql, id)
+	return err
+}
+
+func (db Database) guildSettings(ctx context.Context, id string) (GuildSettings, error) {
+	const sql = `
+	-- name: guildSettings
+	SELECT
+		id::text, create_cooldown, max_owned_channels, max_channels, limit_action
+	FROM
+		discord.guilds
+	WHERE
+		id = $1::int8
+	`
+	return database.One[GuildSettings](ctx, db.q, sql, id)
+}
+
+func (db Database) updateGuildSettings(ctx context.Context, params GuildSettings) (GuildSettings, error) {
+	const sql = `
+	-- name: updateGuildSettings
+	UPDATE
+		discord.guilds
+	SET
+		create_cooldown = $2,
+		max_owned_channels = $3,
+		max_channels = $4,
+		limit_action = $5
+	WHERE
+		id = $1::int8
+	RETURNING
+		id::text, create_cooldown, max_owned_channels, max_channels, limit_action
+	`
+	return database.One[GuildSettings](ctx, db.q, sql, params.GuildID, params.CreateCooldown, params.MaxOwnedChannels, params.MaxChannels, params.LimitAction)
 }
 
 func (db Database) creatorChannel(ctx context.Context, id string) (CreatorChannel, error) {
 	const sql = `
+	-- name: creatorChannel
 	SELECT
-		id::text
+		id::text, guild_id::text, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id::text, nsfw, permissions_channel_id::text, role_ids, delete_delay, owner_policy, disabled, activity_names
 	FROM
 		discord.creator_channels
 	WHERE
 		(id = $1::int8 OR $1 IS NULL)
 	`
-	return database.One[CreatorChannel](ctx, db.pool, sql, id)
+	return database.One[CreatorChannel](ctx, db.q, sql, id)
 }
 
 func (db Database) creatorChannels(ctx context.Context, filter creatorChannelFilter) ([]CreatorChannel, error) {
 	const sql = `
+	-- name: creatorChannels
 	SELECT
-		id, guild_id::text
+		id::text, guild_id::text, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id::text, nsfw, permissions_channel_id::text, role_ids, delete_delay, owner_policy, disabled, activity_names
 	FROM
 		discord.creator_channels
 	WHERE
 		(guild_id = $1::int8 OR $1 IS NULL)
 	`
-	return database.Many[CreatorChannel](ctx, db.pool, sql, filter.guildID)
+	return database.Many[CreatorChannel](ctx, db.q, sql, filter.guildID)
 }
 
 func (db Database) createCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error) {
 	const sql = `
+	-- name: createCreatorChannel
 	INSERT INTO 
-		discord.creator_channels (id, guild_id)
+		discord.creator_channels (id, guild_id, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id, nsfw, permissions_channel_id, role_ids, delete_delay, owner_policy, disabled, activity_names)
 	VALUES
-		($1::int8, $2::int8)
-	RETURNING *
+		($1::int8, $2::int8, $3, $4, $5, $6, $7, $8::int8, $9, $10::int8, $11, $12, $13, $14, $15)
+	RETURNING
+		id::text, guild_id::text, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id::text, nsfw, permissions_channel_id::text, role_ids, delete_delay, owner_policy, disabled, activity_names
+	`
+	return database.One[CreatorChannel](ctx, db.q, sql, params.ID, params.GuildID, params.NameTemplate, params.UserLimit, params.Bitrate, params.VideoQuality, params.RTCRegion,
+		params.CategoryID, params.NSFW, params.PermissionsChannelID, params.RoleIDs, params.DeleteDelay, params.OwnerPolicy, params.Disabled, params.ActivityNames)
+}
+
+func (db Database) updateCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error) {
+	const sql = `
+	-- name: updateCreatorChannel
+	UPDATE
+		discord.creator_channels
+	SET
+		name_template = $3,
+		user_limit = $4,
+		bitrate = $5,
+		video_quality = $6,
+		rtc_region = $7,
+		category_id = $8::int8,
+		nsfw = $9,
+		permissions_channel_id = $10::int8,
+		role_ids = $11,
+		delete_delay = $12,
+		owner_policy = $13,
+		disabled = $14,
+		activity_names = $15
+	WHERE
+		id = $1::int8 AND guild_id = $2::int8
+	RETURNING
+		id::text, guild_id::text, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id::text, nsfw, permissions_channel_id::text, role_ids, delete_delay, owner_policy, disabled, activity_names
+	`
+	return database.One[CreatorChannel](ctx, db.q, sql, params.ID, params.GuildID, params.NameTemplate, params.UserLimit, params.Bitrate, params.VideoQuality, params.RTCRegion,
+		params.CategoryID, params.NSFW, params.PermissionsChannelID, params.RoleIDs, params.DeleteDelay, params.OwnerPolicy, params.Disabled, params.ActivityNames)
+}
+
+func (db Database) deleteCreatorChannel(ctx context.Context, id string) error {
+	const sql = `
+	-- name: deleteCreatorChannel
+	DELETE FROM
+		discord.creator_channels
+	WHERE
+		id = $1::int8
 	`
-	return database.One[CreatorChannel](ctx, db.pool, sql, params.ID, params.GuildID)
+	return expectAffected(database.Exec(ctx, db.q, sql, id))
 }
 
 func (db Database) temporaryChannel(ctx context.Context, id string) (TemporaryChannel, error) {
 	const sql = `
+	-- name: temporaryChannel
 	SELECT
-		id::text
+		id::text, guild_id::text, COALESCE(owner_id::text, '') AS owner_id, COALESCE(creator_id::text, '') AS creator_id, number, delete_at,
+		COALESCE(waiting_room_id::text, '') AS waiting_room_id, COALESCE(base_name, '') AS base_name
 	FROM
 		discord.temporary_channels
 	WHERE
 		(id = $1::int8 OR $1 IS NULL)
 	`
-	return database.One[TemporaryChannel](ctx, db.pool, sql, id)
+	return database.One[TemporaryChannel](ctx, db.q, sql, id)
+}
+
+func (db Database) temporaryChannels(ctx context.Context, filter temporaryChannelFilter) ([]TemporaryChannel, error) {
+	const sql = `
+	-- name: temporaryChannels
+	SELECT
+		id::text, guild_id::text, COALESCE(owner_id::text, '') AS owner_id, COALESCE(creator_id::text, '') AS creator_id, number, delete_at,
+		COALESCE(waiting_room_id::text, '') AS waiting_room_id, COALESCE(base_name, '') AS base_name
+	FROM
+		discord.temporary_channels
+	WHERE
+		(guild_id = $1::int8 OR $1 IS NULL)
+		AND (creator_id = $2::int8 OR $2 IS NULL)
+	`
+	return database.Many[TemporaryChannel](ctx, db.q, sql, filter.guildID, filter.creatorID)
 }
 
 func (db Database) createTemporaryChannel(ctx context.Context, params TemporaryChannel) (TemporaryChannel, error) {
 	const sql = `
+	-- name: createTemporaryChannel
 	INSERT INTO 
-		discord.temporary_channels (id, guild_id)
+		discord.temporary_channels (id, guild_id, owner_id, creator_id, number)
+	VALUES
+		($1::int8, $2::int8, NULLIF($3, '')::int8, NULLIF($4, '')::int8, $5)
+	RETURNING id::text, guild_id::text, COALESCE(owner_id::text, '') AS owner_id, COALESCE(creator_id::text, '') AS creator_id, number, delete_at,
+		COALESCE(waiting_room_id::text, '') AS waiting_room_id, COALESCE(base_name, '') AS base_name
+	`
+	return database.One[TemporaryChannel](ctx, db.q, sql, params.ID, params.GuildID, params.OwnerID, params.CreatorID, params.Number)
+}
+
+func (db Database) deleteTemporaryChannel(ctx context.Context, id string) error {
+	const sql = `
+	-- name: deleteTemporaryChannel
+	DELETE FROM
+		discord.temporary_channels
+	WHERE
+		id = $1::int8
+	`
+	return expectAffected(database.Exec(ctx, db.q, sql, id))
+}
+
+func (db Database) setTemporaryChannelDeleteAt(ctx context.Context, id string, deleteAt sql.NullTime) error {
+	const sql = `
+	-- name: setTemporaryChannelDeleteAt
+	UPDATE
+		discord.temporary_channels
+	SET
+		delete_at = $2
+	WHERE
+		id = $1::int8
+	`
+	return expectAffected(database.Exec(ctx, db.q, sql, id, deleteAt))
+}
+
+func (db Database) setTemporaryChannelWaitingRoom(ctx context.Context, id, waitingRoomID string) error {
+	const sql = `
+	-- name: setTemporaryChannelWaitingRoom
+	UPDATE
+		discord.temporary_channels
+	SET
+		waiting_room_id = NULLIF($2, '')::int8
+	WHERE
+		id = $1::int8
+	`
+	return expectAffected(database.Exec(ctx, db.q, sql, id, waitingRoomID))
+}
+
+func (db Database) setTemporaryChannelBaseName(ctx context.Context, id, baseName string) error {
+	const sql = `
+	-- name: setTemporaryChannelBaseName
+	UPDATE
+		discord.temporary_channels
+	SET
+		base_name = NULLIF($2, '')
+	WHERE
+		id = $1::int8
+	`
+	return expectAffected(database.Exec(ctx, db.q, sql, id, baseName))
+}
+
+func (db Database) transferTemporaryChannel(ctx context.Context, id, fromOwnerID, toOwnerID string) error {
+	const sql = `
+	-- name: transferTemporaryChannel
+	UPDATE
+		discord.temporary_channels
+	SET
+		owner_id = NULLIF($3, '')::int8
+	WHERE
+		id = $1::int8 AND owner_id IS NOT DISTINCT FROM NULLIF($2, '')::int8
+	`
+	return expectUpdated(database.Exec(ctx, db.q, sql, id, fromOwnerID, toOwnerID))
+}
+
+func (db Database) userPreferences(ctx context.Context, guildID, userID string) (UserPreferences, error) {
+	const sql = `
+	-- name: userPreferences
+	SELECT
+		guild_id::text, user_id::text, name, user_limit, locked, hidden,
+		permitted_user_ids, permitted_role_ids, rejected_user_ids, opted_out
+	FROM
+		discord.user_preferences
+	WHERE
+		guild_id = $1::int8 AND user_id = $2::int8
+	`
+	return database.One[UserPreferences](ctx, db.q, sql, guildID, userID)
+}
+
+func (db Database) saveUserPreferences(ctx context.Context, params UserPreferences) (UserPreferences, error) {
+	const sql = `
+	-- name: saveUserPreferences
+	INSERT INTO
+		discord.user_preferences (guild_id, user_id, name, user_limit, locked, hidden,
+		permitted_user_ids, permitted_role_ids, rejected_user_ids, opted_out)
 	VALUES
-		($1::int8, $2::int8)
-	RETURNING *
+		($1::int8, $2::int8, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (guild_id, user_id) DO UPDATE SET
+		name = excluded.name,
+		user_limit = excluded.user_limit,
+		locked = excluded.locked,
+		hidden = excluded.hidden,
+		permitted_user_ids = excluded.permitted_user_ids,
+		permitted_role_ids = excluded.permitted_role_ids,
+		rejected_user_ids = excluded.rejected_user_ids,
+		opted_out = excluded.opted_out
+	RETURNING
+		guild_id::text, user_id::text, name, user_limit, locked, hidden,
+		permitted_user_ids, permitted_role_ids, rejected_user_ids, opted_out
+	`
+	return database.One[UserPreferences](ctx, db.q, sql, params.GuildID, params.UserID, params.Name, params.UserLimit, params.Locked, params.Hidden,
+		params.PermittedUserIDs, params.PermittedRoleIDs, params.RejectedUserIDs, params.OptedOut)
+}
+
+func (db Database) createChannelSession(ctx context.Context, params ChannelSession) error {
+	const sql = `
+	-- name: createChannelSession
+	INSERT INTO
+		discord.channel_sessions (channel_id, guild_id, creator_id, owner_id, created_at)
+	VALUES
+		($1::int8, $2::int8, NULLIF($3, '')::int8, NULLIF($4, '')::int8, $5)
+	`
+	_, err := database.Exec(ctx, db.q, sql, params.ChannelID, params.GuildID, params.CreatorID, params.OwnerID, params.CreatedAt)
+	return err
+}
+
+func (db Database) raiseChannelSessionPeak(ctx context.Context, channelID string, members int) error {
+	const sql = `
+	-- name: raiseChannelSessionPeak
+	UPDATE
+		discord.channel_sessions
+	SET
+		peak_members = GREATEST(peak_members, $2)
+	WHERE
+		channel_id = $1::int8
+	`
+	return expectAffected(database.Exec(ctx, db.q, sql, channelID, members))
+}
+
+func (db Database) endChannelSession(ctx context.Context, channelID string, deletedAt time.Time, memberSeconds int64) error {
+	const sql = `
+	-- name: endChannelSession
+	UPDATE
+		discord.channel_sessions
+	SET
+		deleted_at = $2,
+		member_seconds = $3
+	WHERE
+		channel_id = $1::int8 AND deleted_at IS NULL
+	`
+	return expectAffected(database.Exec(ctx, db.q, sql, channelID, deletedAt, memberSeconds))
+}
+
+func (db Database) channelSessions(ctx context.Context, filter historyFilter) ([]ChannelSession, error) {
+	const sql = `
+	-- name: channelSessions
+	SELECT
+		channel_id::text, guild_id::text, COALESCE(creator_id::text, '') AS creator_id, COALESCE(owner_id::text, '') AS owner_id,
+		created_at, deleted_at, peak_members, member_seconds
+	FROM
+		discord.channel_sessions
+	WHERE
+		(guild_id = $1::int8 OR $1 IS NULL)
+		AND (channel_id = $2::int8 OR $2 IS NULL)
+		AND (deleted_at IS NULL OR deleted_at >= $3::timestamptz OR $3::timestamptz IS NULL)
+	`
+	return database.Many[ChannelSession](ctx, db.q, sql, filter.guildID, filter.channelID, filter.since)
+}
+
+func (db Database) startMemberSession(ctx context.Context, params MemberSession) error {
+	const sql = `
+	-- name: startMemberSession
+	INSERT INTO
+		discord.member_sessions (guild_id, channel_id, user_id, joined_at)
+	SELECT
+		$1::int8, $2::int8, $3::int8, $4
+	WHERE NOT EXISTS (
+		SELECT 1 FROM discord.member_sessions WHERE channel_id = $2::int8 AND user_id = $3::int8 AND left_at IS NULL
+	)
 	`
-	return database.One[TemporaryChannel](ctx, db.pool, sql, params.ID, params.GuildID)
+	_, err := database.Exec(ctx, db.q, sql, params.GuildID, params.ChannelID, params.UserID, params.JoinedAt)
+	return err
+}
+
+func (db Database) endMemberSessions(ctx context.Context, channelID, userID string, leftAt time.Time) error {
+	const sql = `
+	-- name: endMemberSessions
+	UPDATE
+		discord.member_sessions
+	SET
+		left_at = $3
+	WHERE
+		channel_id = $1::int8 AND (user_id = NULLIF($2, '')::int8 OR $2 = '') AND left_at IS NULL
+	`
+	_, err := database.Exec(ctx, db.q, sql, channelID, userID, leftAt)
+	return err
+}
+
+func (db Database) memberSessions(ctx context.Context, filter historyFilter) ([]MemberSession, error) {
+	const sql = `
+	-- name: memberSessions
+	SELECT
+		guild_id::text, channel_id::text, user_id::text, joined_at, left_at
+	FROM
+		discord.member_sessions
+	WHERE
+		(guild_id = $1::int8 OR $1 IS NULL)
+		AND (channel_id = $2::int8 OR $2 IS NULL)
+		AND (left_at IS NULL OR left_at >= $3::timestamptz OR $3::timestamptz IS NULL)
+	`
+	return database.Many[MemberSession](ctx, db.q, sql, filter.guildID, filter.channelID, filter.since)
+}
+
+func (db Database) pruneHistory(ctx context.Context, before time.Time) error {
+	const sql = `
+	-- name: pruneHistory
+	WITH
+		channel_sessions AS (DELETE FROM discord.channel_sessions WHERE deleted_at < $1)
+	DELETE FROM
+		discord.member_sessions
+	WHERE
+		left_at < $1
+	`
+	_, err := database.Exec(ctx, db.q, sql, before)
+	return err
 }
 
 func (db Database) group(ctx context.Context, id int64) (Group, error) {
 	const sql = `
+	-- name: group
 	SELECT
-		*
+		id, name, guild_id::text
 	FROM
 		discord.groups
 	WHERE
 		(id = $1 OR $1 IS NULL)
 	`
-	return database.One[Group](ctx, db.pool, sql, id)
+	return database.One[Group](ctx, db.q, sql, id)
 }
 
 func (db Database) groups(ctx context.Context, filter GroupFilter) ([]Group, error) {
 	const sql = `
+	-- name: groups
+	SELECT
+		id, name, guild_id::text
+	FROM
+		discord.groups
+	WHERE
+		(guild_id = $1::int8 OR $1 IS NULL)
+		AND (name = $2 OR $2 IS NULL)
+	`
+	return database.Many[Group](ctx, db.q, sql, filter.guildID, filter.name)
+}
+
+func (db Database) groupsPage(ctx context.Context, filter GroupFilter, cursor database.Cursor, limit int) (database.Page[Group], error) {
+	const sql = `
+	-- name: groupsPage
 	SELECT
 		id, name, guild_id::text
 	FROM
 		discord.groups
 	WHERE
 		(guild_id = $1::int8 OR $1 IS NULL)
+		AND (name = $2 OR $2 IS NULL)
+		AND (id > $3::int8 OR $3 IS NULL)
+	ORDER BY
+		id
+	LIMIT $4
 	`
-	return database.Many[Group](ctx, db.pool, sql, filter.guildID)
+	return database.Paginate(ctx, db.q, sql, cursor, limit, groupKey, filter.guildID, filter.name)
 }
 
 func (db Database) createGroup(ctx context.Context, params GroupParams) (Group, error) {
 	const sql = `
+	-- name: createGroup
 	INSERT INTO 
 		discord.groups (name, guild_id)
 	VALUES
-		($1, $2)
-	RETURNING *
+		($1, $2::int8)
+	RETURNING id, name, guild_id::text
 	`
-	return database.One[Group](ctx, db.pool, sql, params.name, params.guildID)
+	return database.One[Group](ctx, db.q, sql, params.name, params.guildID)
 }
@@ -0,0 +1,167 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// maxDeleteDelay is the longest time empty temporary channels can be kept, in seconds.
+const maxDeleteDelay = 24 * 60 * 60
+
+// deletionTimers holds the timers of the empty temporary channels waiting to be deleted by this instance.
+// The deletion time is persisted too, so that deletions are rescheduled after a restart by reconcileGuild.
+type deletionTimers struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newDeletionTimers() *deletionTimers {
+	return &deletionTimers{
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// start calls fn after delay unless a timer for the channel is running already.
+func (t *deletionTimers) start(channelID string, delay time.Duration, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.timers[channelID]; ok {
+		return
+	}
+	t.timers[channelID] = time.AfterFunc(delay, func() {
+		t.mu.Lock()
+		delete(t.timers, channelID)
+		t.mu.Unlock()
+
+		fn()
+	})
+}
+
+// stop cancels the timer of a channel, if any.
+func (t *deletionTimers) stop(channelID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if timer, ok := t.timers[channelID]; ok {
+		timer.Stop()
+		delete(t.timers, channelID)
+	}
+}
+
+// stopAll cancels all timers, the persisted deletion times are kept.
+func (t *deletionTimers) stopAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for channelID, timer := range t.timers {
+		timer.Stop()
+		delete(t.timers, channelID)
+	}
+}
+
+// deleteWhenEmpty deletes an empty temporary channel once the delay of its creator channel has passed,
+// or at the time persisted earlier. Joining the channel in the meantime cancels the deletion.
+func (d Discord) deleteWhenEmpty(ctx context.Context, s *dgo.Session, channel TemporaryChannel) error {
+	deleteAt := channel.DeleteAt.Time
+	if !channel.DeleteAt.Valid {
+		delay, err := d.deleteDelay(ctx, channel)
+		if err != nil {
+			return err
+		}
+		if delay == 0 {
+			return d.deleteEmptyChannel(ctx, s, channel)
+		}
+
+		deleteAt = time.Now().Add(delay)
+		if err := d.db.setTemporaryChannelDeleteAt(ctx, channel.ID, sql.NullTime{Time: deleteAt, Valid: true}); err != nil {
+			return fmt.Errorf("unable to schedule deletion of temporary channel (id=%v): %w", channel.ID, err)
+		}
+		slog.Info("Scheduled deletion of empty temporary channel", "guild_id", channel.GuildID, "channel", channel.ID, "delete_at", deleteAt)
+	}
+
+	d.deletions.start(channel.ID, time.Until(deleteAt), func() {
+		if err := d.deletePending(s, channel.ID); err != nil {
+			slog.Error("Unable to delete empty temporary channel", "guild_id", channel.GuildID, "channel", channel.ID, "error", err)
+		}
+	})
+	return nil
+}
+
+// cancelDeletion stops a pending deletion of a temporary channel, for example because a member rejoined.
+func (d Discord) cancelDeletion(ctx context.Context, channelID string) error {
+	d.deletions.stop(channelID)
+
+	err := d.db.setTemporaryChannelDeleteAt(ctx, channelID, sql.NullTime{})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to cancel deletion of temporary channel (id=%v): %w", channelID, err)
+	}
+	return nil
+}
+
+// deletePending deletes a temporary channel whose deletion is due, unless it was cancelled in the meantime,
+// possibly by another instance.
+func (d Discord) deletePending(s *dgo.Session, channelID string) error {
+	ctx := context.Background()
+	unlock := d.locks.lock(channelID)
+	defer unlock()
+
+	channel, err := d.db.temporaryChannel(ctx, channelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get temporary channel: %w", err)
+	}
+	if !channel.DeleteAt.Valid || channel.DeleteAt.Time.After(time.Now()) {
+		return nil
+	}
+
+	return d.deleteEmptyChannel(ctx, s, channel)
+}
+
+// deleteEmptyChannel deletes a temporary channel and its waiting room unless members are in it.
+func (d Discord) deleteEmptyChannel(ctx context.Context, s *dgo.Session, channel TemporaryChannel) error {
+	guild, err := s.State.Guild(channel.GuildID)
+	if err != nil {
+		return fmt.Errorf("unable to get guild from state cache: %w", err)
+	}
+	if channelHasUsers(guild, channel.ID) {
+		// Must not delete a temporary channel if users are still in it.
+		return d.cancelDeletion(ctx, channel.ID)
+	}
+
+	if err := d.removeWaitingRoom(ctx, s, channel); err != nil {
+		slog.Warn("Unable to remove waiting room", "channel", channel.ID, "error", err)
+	}
+	if _, err := s.ChannelDelete(channel.ID); err != nil {
+		return fmt.Errorf("unable to delete channel: %w", err)
+	}
+
+	return d.forgetTemporaryChannel(ctx, channel.GuildID, channel.ID)
+}
+
+// deleteDelay returns how long an empty temporary channel is kept according to its creator channel.
+func (d Discord) deleteDelay(ctx context.Context, channel TemporaryChannel) (time.Duration, error) {
+	if channel.CreatorID == "" {
+		return 0, nil
+	}
+
+	creator, err := d.db.creatorChannel(ctx, channel.CreatorID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// The creator channel was deleted since.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to get creator channel: %w", err)
+	}
+	return time.Duration(creator.DeleteDelay) * time.Second, nil
+}
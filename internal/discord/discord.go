@@ -2,41 +2,194 @@ package discord
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"time"
 
 	dgo "github.com/bwmarrin/discordgo"
 )
 
 type Discord struct {
-	session *dgo.Session
-	db      Database
-	config  runtimeConfig
+	session     *dgo.Session
+	db          Storage
+	cache       *channelCache
+	deletions   *deletionTimers
+	joins       *memberJoins
+	cooldowns   *createCooldowns
+	events      *guildQueues
+	locks       *channelLocks
+	activities  *activityRenames
+	broadcaster Broadcaster
+	config      runtimeConfig
+
+	// instanceID identifies this process in broadcast changes.
+	instanceID string
 }
 
 type Config struct {
 	Token          string
 	Guild          string
 	DeleteCommands bool
+
+	// CacheMaxGuilds is the number of guilds whose creator and temporary channels are cached.
+	CacheMaxGuilds int
+
+	// Broadcaster, if set, keeps the state of several instances sharing the storage consistent.
+	Broadcaster Broadcaster
+
+	// Presences requests the privileged presence intent, which must be enabled for the bot in the developer
+	// portal. Without it, temporary channels cannot be named after the activities of their members.
+	Presences bool
 }
 
 type runtimeConfig struct {
 	guild          string
 	deleteCommands bool
+	presences      bool
+}
+
+// GuildSettings limit how members of a guild create temporary channels. Limits of 0 are disabled.
+type GuildSettings struct {
+	GuildID string `db:"id"`
+
+	// CreateCooldown is the number of seconds a member has to wait between creating temporary channels.
+	CreateCooldown int `db:"create_cooldown"`
+
+	// MaxOwnedChannels is how many temporary channels a member may own at once.
+	MaxOwnedChannels int `db:"max_owned_channels"`
+
+	// MaxChannels is how many temporary channels may exist in the guild at once.
+	MaxChannels int `db:"max_channels"`
+
+	// LimitAction is what happens to members who hit a limit, see limitActionMove.
+	LimitAction string `db:"limit_action"`
 }
 
 type CreatorChannel struct {
 	ID      string `db:"id"`
 	GuildID string `db:"guild_id"`
+
+	// NameTemplate is the name of the temporary channels, see renderName.
+	NameTemplate string `db:"name_template"`
+
+	// Settings of the temporary channels. Unset settings are copied from the creator channel
+	// where Discord reports them, and left to Discord otherwise.
+	UserLimit    sql.NullInt64  `db:"user_limit"`
+	Bitrate      sql.NullInt64  `db:"bitrate"`
+	VideoQuality sql.NullInt64  `db:"video_quality"`
+	RTCRegion    sql.NullString `db:"rtc_region"`
+	CategoryID   sql.NullString `db:"category_id"`
+	NSFW         bool           `db:"nsfw"`
+
+	// PermissionsChannelID is the channel whose permission overwrites temporary channels get,
+	// the creator channel if unset.
+	PermissionsChannelID sql.NullString `db:"permissions_channel_id"`
+
+	// RoleIDs are comma separated roles, if any, only members of which may see and join temporary channels.
+	RoleIDs string `db:"role_ids"`
+
+	// DeleteDelay is the number of seconds empty temporary channels are kept, so that members can rejoin.
+	DeleteDelay int `db:"delete_delay"`
+
+	// OwnerPolicy chooses the new owner of a temporary channel when its owner leaves, see ownerPolicyLongest.
+	OwnerPolicy string `db:"owner_policy"`
+
+	// Disabled creator channels do not create temporary channels.
+	Disabled bool `db:"disabled"`
+
+	// ActivityNames names temporary channels after the most common activity of their members, see renameAfterActivity.
+	ActivityNames bool `db:"activity_names"`
 }
 
 type creatorChannelFilter struct {
-	guildID string
+	guildID sql.NullString
 }
 
 type TemporaryChannel struct {
 	ID      string `db:"id"`
 	GuildID string `db:"guild_id"`
+
+	// OwnerID is empty if the channel has no owner and can be claimed.
+	OwnerID string `db:"owner_id"`
+
+	// CreatorID is the creator channel the channel was created from, Number its counter within
+	// that creator. Channels created before creators were tracked have neither.
+	CreatorID string `db:"creator_id"`
+	Number    int    `db:"number"`
+
+	// DeleteAt is set while the channel is empty and waits to be deleted.
+	DeleteAt sql.NullTime `db:"delete_at"`
+
+	// WaitingRoomID is the voice channel in which members knock to be let in, empty if there is none.
+	WaitingRoomID string `db:"waiting_room_id"`
+
+	// BaseName is the name restored once the activity the channel is named after ends, empty if it is not
+	// named after one.
+	BaseName string `db:"base_name"`
+}
+
+type temporaryChannelFilter struct {
+	guildID   sql.NullString
+	creatorID sql.NullString
+}
+
+// ChannelSession records the lifetime of a temporary channel.
+type ChannelSession struct {
+	ChannelID string `db:"channel_id"`
+	GuildID   string `db:"guild_id"`
+
+	// CreatorID and OwnerID are empty if unknown, OwnerID is the owner the channel was created for.
+	CreatorID string `db:"creator_id"`
+	OwnerID   string `db:"owner_id"`
+
+	CreatedAt time.Time `db:"created_at"`
+
+	// DeletedAt is unset while the channel exists.
+	DeletedAt sql.NullTime `db:"deleted_at"`
+
+	// PeakMembers is the highest number of members that were in the channel at once.
+	PeakMembers int `db:"peak_members"`
+
+	// MemberSeconds is the time all members spent in the channel, set when it is deleted.
+	MemberSeconds int64 `db:"member_seconds"`
+}
+
+// MemberSession records a stay of a member in a temporary channel.
+type MemberSession struct {
+	GuildID   string    `db:"guild_id"`
+	ChannelID string    `db:"channel_id"`
+	UserID    string    `db:"user_id"`
+	JoinedAt  time.Time `db:"joined_at"`
+
+	// LeftAt is unset while the member is in the channel.
+	LeftAt sql.NullTime `db:"left_at"`
+}
+
+// historyFilter selects channel and member sessions. since selects the sessions that did not end before it.
+type historyFilter struct {
+	guildID   sql.NullString
+	channelID sql.NullString
+	since     sql.NullTime
+}
+
+// UserPreferences are the settings a user last gave their temporary channels in a guild,
+// they are applied to the next temporary channel of the user. Lists hold comma separated IDs.
+type UserPreferences struct {
+	GuildID          string         `db:"guild_id"`
+	UserID           string         `db:"user_id"`
+	Name             sql.NullString `db:"name"`
+	UserLimit        sql.NullInt64  `db:"user_limit"`
+	Locked           bool           `db:"locked"`
+	Hidden           bool           `db:"hidden"`
+	PermittedUserIDs string         `db:"permitted_user_ids"`
+	PermittedRoleIDs string         `db:"permitted_role_ids"`
+	RejectedUserIDs  string         `db:"rejected_user_ids"`
+
+	// OptedOut users have their preferences neither remembered nor applied.
+	OptedOut bool `db:"opted_out"`
 }
 
 type Group struct {
@@ -52,40 +205,87 @@ type GroupParams struct {
 
 type GroupFilter struct {
 	guildID sql.NullString
+	name    sql.NullString
 }
 
-func Make(config Config, db Database) (Discord, error) {
+func Make(config Config, db Storage) (Discord, error) {
 	session, err := dgo.New(fmt.Sprintf("Bot %v", config.Token))
 	if err != nil {
 		return Discord{}, fmt.Errorf("unable to create session: %w", err)
 	}
 
 	session.Identify.Intents = dgo.IntentGuilds | dgo.IntentGuildVoiceStates
+	if config.Presences {
+		session.Identify.Intents |= dgo.IntentGuildPresences
+	}
+
+	// Handlers run on the gateway goroutine so that events reach them in order, they must hand off
+	// anything slow to another goroutine, see guildQueues.
+	session.SyncEvents = true
 
-	return Discord{
-		session: session,
-		db:      db,
+	instanceID := make([]byte, 8)
+	if _, err := rand.Read(instanceID); err != nil {
+		return Discord{}, fmt.Errorf("unable to generate instance id: %w", err)
+	}
+
+	d := Discord{
+		session:     session,
+		db:          db,
+		cache:       newChannelCache(db, config.CacheMaxGuilds),
+		deletions:   newDeletionTimers(),
+		joins:       newMemberJoins(),
+		cooldowns:   newCreateCooldowns(),
+		locks:       newChannelLocks(),
+		activities:  newActivityRenames(),
+		broadcaster: config.Broadcaster,
 		config: runtimeConfig{
 			guild:          config.Guild,
 			deleteCommands: config.DeleteCommands,
+			presences:      config.Presences,
 		},
-	}, nil
+		instanceID: hex.EncodeToString(instanceID),
+	}
+	// Dropped voice state updates are made up for by reconciling the guild, in its worker so that it
+	// does not race with the events queued after.
+	d.events = newGuildQueues(func(guildID string) {
+		if err := d.reconcileGuild(context.Background(), d.session, guildID); err != nil {
+			slog.Error("Unable to reconcile guild", "guild_id", guildID, "error", err)
+		}
+	})
+	d.subscribeChanges()
+
+	return d, nil
 }
 
 func (d Discord) Run(ctx context.Context) error {
+	d.guildEvents()
+
 	if err := d.session.Open(); err != nil {
 		return fmt.Errorf("unable to open session: %w", err)
 	}
 	defer d.session.Close()
+	defer d.deletions.stopAll()
+	defer d.activities.stopAll()
 
 	if d.config.deleteCommands {
 		defer d.deleteCommands()
 	}
 
+	if err := d.cache.warm(ctx); err != nil {
+		slog.Warn("Unable to warm channel cache", "error", err)
+	}
+
 	d.commands()
 	d.voiceStates()
+	d.presences()
+	go d.reconcilePeriodically(ctx)
 
 	<-ctx.Done()
 
 	return nil
 }
+
+// CacheStats returns a snapshot of the channel cache statistics.
+func (d Discord) CacheStats() CacheStats {
+	return d.cache.stats()
+}
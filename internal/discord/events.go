@@ -0,0 +1,152 @@
+package discord
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// guildQueueSize is how many events of a guild may wait to be handled, further events are dropped.
+	guildQueueSize = 256
+
+	// guildQueueIdle is how long the worker of a guild waits for events before it stops.
+	guildQueueIdle = time.Minute
+)
+
+// guildQueues handles the events of each guild one after another in the order they were received,
+// while events of different guilds are handled concurrently. push never blocks, since the session
+// handles events synchronously and waiting would hold up the gateway for all guilds. Events pushed to a
+// full queue are dropped instead, and once the queue drained, overflow is called for the guild to catch up.
+type guildQueues struct {
+	mu     sync.Mutex
+	queues map[string]*guildQueue
+
+	// overflow is called by the worker of a guild after events of it were dropped and its queue drained.
+	overflow func(guildID string)
+
+	size int
+	idle time.Duration
+}
+
+type guildQueue struct {
+	events chan func()
+
+	// pending counts the events queued but not handled yet, the worker only stops if it is 0.
+	pending int
+
+	// dropped counts the events dropped since the queue was last drained.
+	dropped int
+}
+
+func newGuildQueues(overflow func(guildID string)) *guildQueues {
+	return &guildQueues{
+		queues:   make(map[string]*guildQueue),
+		overflow: overflow,
+		size:     guildQueueSize,
+		idle:     guildQueueIdle,
+	}
+}
+
+// push queues fn to be called after the events of the guild pushed before it, starting a worker if needed.
+// It drops fn if the queue of the guild is full.
+func (q *guildQueues) push(guildID string, fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queue, ok := q.queues[guildID]
+	if !ok {
+		queue = &guildQueue{events: make(chan func(), q.size)}
+		q.queues[guildID] = queue
+		go q.work(guildID, queue)
+	}
+
+	select {
+	case queue.events <- fn:
+		queue.pending++
+	default:
+		if queue.dropped == 0 {
+			slog.Warn("Event queue of guild is full, dropping events until it drained", "guild_id", guildID, "size", q.size)
+		}
+		queue.dropped++
+	}
+}
+
+// work handles the events of a guild until none arrived for q.idle.
+func (q *guildQueues) work(guildID string, queue *guildQueue) {
+	idle := time.NewTimer(q.idle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case fn := <-queue.events:
+			fn()
+
+			q.mu.Lock()
+			queue.pending--
+			dropped := 0
+			if queue.pending == 0 {
+				dropped, queue.dropped = queue.dropped, 0
+			}
+			q.mu.Unlock()
+
+			if dropped > 0 {
+				slog.Warn("Event queue of guild drained after dropping events", "guild_id", guildID, "dropped", dropped)
+				q.overflow(guildID)
+			}
+		case <-idle.C:
+			q.mu.Lock()
+			if queue.pending == 0 {
+				delete(q.queues, guildID)
+				q.mu.Unlock()
+				return
+			}
+			q.mu.Unlock()
+		}
+		idle.Reset(q.idle)
+	}
+}
+
+// channelLocks serializes decisions about a channel, such as creating a temporary channel for a member
+// of a creator channel or deleting an empty temporary channel, between events, timers and reconciliation.
+type channelLocks struct {
+	mu    sync.Mutex
+	locks map[string]*channelLock
+}
+
+type channelLock struct {
+	mu sync.Mutex
+
+	// refs counts the holders and waiters of the lock, it is dropped once 0.
+	refs int
+}
+
+func newChannelLocks() *channelLocks {
+	return &channelLocks{
+		locks: make(map[string]*channelLock),
+	}
+}
+
+// lock locks a channel and returns the function unlocking it. Locks are not reentrant.
+func (l *channelLocks) lock(channelID string) (unlock func()) {
+	l.mu.Lock()
+	lock, ok := l.locks[channelID]
+	if !ok {
+		lock = &channelLock{}
+		l.locks[channelID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, channelID)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,203 @@
+package discord
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitTimeout fails the test if wg is not done within a second.
+func waitTimeout(t *testing.T, wg *sync.WaitGroup) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for events")
+	}
+}
+
+func TestGuildQueuesOrder(t *testing.T) {
+	q := newGuildQueues(func(string) {})
+
+	const events = 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	handled := make(map[string][]int)
+	for i := range events {
+		for _, guildID := range []string{"1", "2"} {
+			wg.Add(1)
+			q.push(guildID, func() {
+				defer wg.Done()
+				mu.Lock()
+				handled[guildID] = append(handled[guildID], i)
+				mu.Unlock()
+			})
+		}
+	}
+	waitTimeout(t, &wg)
+
+	for guildID, order := range handled {
+		if len(order) != events {
+			t.Fatalf("guild %v: handled %v events, want %v", guildID, len(order), events)
+		}
+		for i, event := range order {
+			if event != i {
+				t.Fatalf("guild %v: handled event %v at position %v", guildID, event, i)
+			}
+		}
+	}
+}
+
+func TestGuildQueuesConcurrentGuilds(t *testing.T) {
+	q := newGuildQueues(func(string) {})
+
+	// The event of guild 1 only finishes once the event of guild 2 ran.
+	release := make(chan struct{})
+	done := make(chan struct{})
+	q.push("1", func() {
+		<-release
+		close(done)
+	})
+	q.push("2", func() { close(release) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("guild 2 waited for guild 1")
+	}
+}
+
+func TestGuildQueuesIdleExit(t *testing.T) {
+	q := newGuildQueues(func(string) {})
+	q.idle = time.Millisecond
+
+	// Pushes land right before, while and after the worker stops.
+	var wg sync.WaitGroup
+	for i := range 200 {
+		wg.Add(1)
+		q.push("1", wg.Done)
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+	}
+	waitTimeout(t, &wg)
+
+	time.Sleep(20 * time.Millisecond)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.queues) != 0 {
+		t.Fatalf("%v queues left after idling, want 0", len(q.queues))
+	}
+}
+
+func TestGuildQueuesOverflow(t *testing.T) {
+	overflows := make(chan string, 10)
+	q := newGuildQueues(func(guildID string) { overflows <- guildID })
+	q.size = 2
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	q.push("1", func() {
+		<-release
+		wg.Done()
+	})
+	// Wait for the worker to take the blocking event, so that the queue is empty.
+	for {
+		q.mu.Lock()
+		empty := len(q.queues["1"].events) == 0
+		q.mu.Unlock()
+		if empty {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var mu sync.Mutex
+	handled := 0
+	for range 5 {
+		wg.Add(1)
+		q.push("1", func() {
+			mu.Lock()
+			handled++
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	// Three of the five events were dropped.
+	wg.Add(-3)
+	close(release)
+	waitTimeout(t, &wg)
+
+	if handled != 2 {
+		t.Fatalf("handled %v events, want 2", handled)
+	}
+	select {
+	case guildID := <-overflows:
+		if guildID != "1" {
+			t.Fatalf("overflow of guild %v, want 1", guildID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("overflow was not called")
+	}
+	if len(overflows) != 0 {
+		t.Fatalf("overflow called %v more times, want once", len(overflows))
+	}
+}
+
+func TestChannelLocks(t *testing.T) {
+	l := newChannelLocks()
+
+	var wg sync.WaitGroup
+	counter := 0
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := l.lock("1")
+			counter++
+			unlock()
+		}()
+	}
+	waitTimeout(t, &wg)
+
+	if counter != 100 {
+		t.Fatalf("counter is %v, want 100", counter)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.locks) != 0 {
+		t.Fatalf("%v locks left, want 0", len(l.locks))
+	}
+}
+
+func TestChannelLocksExclusive(t *testing.T) {
+	l := newChannelLocks()
+
+	unlock := l.lock("1")
+	locked := make(chan struct{})
+	go func() {
+		unlock := l.lock("1")
+		close(locked)
+		unlock()
+	}()
+
+	// Other channels are not affected.
+	l.lock("2")()
+
+	select {
+	case <-locked:
+		t.Fatal("locked a channel twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("channel stayed locked after unlock")
+	}
+}
@@ -0,0 +1,105 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// guildEvents adds handlers keeping stored guilds and channels in line with Discord. It must be
+// called before the session is opened, so that the GuildCreate events sent on connect are seen.
+func (d Discord) guildEvents() {
+	d.session.AddHandler(func(s *dgo.Session, e *dgo.GuildCreate) {
+		go func() {
+			if err := d.guildCreate(context.Background(), s, e); err != nil {
+				slog.Error("Unable to set up guild", "guild_id", e.ID, "error", err)
+			}
+		}()
+	})
+	d.session.AddHandler(func(s *dgo.Session, e *dgo.GuildDelete) {
+		go func() {
+			if err := d.guildDelete(context.Background(), e); err != nil {
+				slog.Error("Unable to delete guild", "guild_id", e.ID, "error", err)
+			}
+		}()
+	})
+	d.session.AddHandler(func(s *dgo.Session, e *dgo.ChannelDelete) {
+		go func() {
+			if err := d.channelDelete(context.Background(), s, e); err != nil {
+				slog.Error("Unable to forget deleted channel", "guild_id", e.GuildID, "channel", e.ID, "error", err)
+			}
+		}()
+	})
+}
+
+// guildCreate is called when the bot joins a guild and whenever a guild becomes available,
+// including on startup and after an outage.
+func (d Discord) guildCreate(ctx context.Context, s *dgo.Session, e *dgo.GuildCreate) error {
+	if err := d.db.ensureGuild(ctx, e.ID); err != nil {
+		return fmt.Errorf("unable to create guild: %w", err)
+	}
+
+	if err := d.reconcileGuild(ctx, s, e.ID); err != nil {
+		return fmt.Errorf("unable to reconcile guild: %w", err)
+	}
+	return nil
+}
+
+// guildDelete purges all data of a guild the bot was removed from.
+func (d Discord) guildDelete(ctx context.Context, e *dgo.GuildDelete) error {
+	if e.Unavailable {
+		// The guild is only unavailable due to an outage, it comes back with a GuildCreate.
+		return nil
+	}
+
+	slog.Info("Removed from guild, deleting its data", "guild_id", e.ID)
+	if err := d.db.deleteGuild(ctx, e.ID); err != nil {
+		return err
+	}
+	d.cache.invalidate(e.ID)
+	d.publishChange(changeGuildDeleted, e.ID, "")
+
+	return nil
+}
+
+// channelDelete forgets creator channels, temporary channels and waiting rooms that were deleted,
+// whether by a member or by the bot itself. Waiting rooms of deleted temporary channels are deleted too.
+func (d Discord) channelDelete(ctx context.Context, s *dgo.Session, e *dgo.ChannelDelete) error {
+	if e.GuildID == "" {
+		return nil
+	}
+
+	ok, err := d.cache.isCreatorChannel(ctx, e.GuildID, e.ID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		slog.Info("Creator channel was deleted", "guild_id", e.GuildID, "channel", e.ID)
+		return d.forgetCreatorChannel(ctx, e.GuildID, e.ID)
+	}
+
+	ok, err = d.cache.isTemporaryChannel(ctx, e.GuildID, e.ID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if channel, err := d.db.temporaryChannel(ctx, e.ID); err == nil {
+			if err := d.removeWaitingRoom(ctx, s, channel); err != nil {
+				slog.Warn("Unable to remove waiting room", "channel", e.ID, "error", err)
+			}
+		}
+		return d.forgetTemporaryChannel(ctx, e.GuildID, e.ID)
+	}
+
+	temporaryChannelID, err := d.cache.waitingRoom(ctx, e.GuildID, e.ID)
+	if err != nil {
+		return err
+	}
+	if temporaryChannelID != "" {
+		return d.forgetWaitingRoom(ctx, e.GuildID, e.ID, temporaryChannelID)
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package discord
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+const (
+	// historyRetention is how long channel and member sessions are kept after they ended.
+	historyRetention = 90 * 24 * time.Hour
+
+	// statsListLimit is the maximum number of creator channels listed by /tempvoice stats.
+	statsListLimit = 15
+)
+
+// statsWindows are the time windows /tempvoice stats can summarize, keyed by option value.
+var statsWindows = map[string]time.Duration{
+	"day":     24 * time.Hour,
+	"week":    7 * 24 * time.Hour,
+	"month":   30 * 24 * time.Hour,
+	"quarter": historyRetention,
+}
+
+// recordChannelCreated starts the session of a new temporary channel.
+// Failures of the record functions are logged only, history is not worth failing the channel for.
+func (d Discord) recordChannelCreated(channel TemporaryChannel) {
+	session := ChannelSession{
+		ChannelID: channel.ID,
+		GuildID:   channel.GuildID,
+		CreatorID: channel.CreatorID,
+		OwnerID:   channel.OwnerID,
+		CreatedAt: time.Now(),
+	}
+	if err := d.db.createChannelSession(context.Background(), session); err != nil {
+		slog.Warn("Unable to record channel session", "channel", channel.ID, "error", err)
+	}
+}
+
+// recordJoin starts the session of a member who joined a temporary channel and updates the peak of the channel.
+func (d Discord) recordJoin(s *dgo.Session, e *dgo.VoiceState) {
+	if e.Member != nil && e.Member.User != nil && e.Member.User.Bot {
+		return
+	}
+
+	ctx := context.Background()
+	session := MemberSession{
+		GuildID:   e.GuildID,
+		ChannelID: e.ChannelID,
+		UserID:    e.UserID,
+		JoinedAt:  time.Now(),
+	}
+	if err := d.db.startMemberSession(ctx, session); err != nil {
+		slog.Warn("Unable to record member session", "channel", e.ChannelID, "user", e.UserID, "error", err)
+		return
+	}
+
+	members := len(channelMembers(s, e.GuildID, e.ChannelID, ""))
+	err := d.db.raiseChannelSessionPeak(ctx, e.ChannelID, members)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		slog.Warn("Unable to record peak members", "channel", e.ChannelID, "error", err)
+	}
+}
+
+// recordLeave ends the session of a member who left a temporary channel.
+func (d Discord) recordLeave(channelID, userID string) {
+	if err := d.db.endMemberSessions(context.Background(), channelID, userID, time.Now()); err != nil {
+		slog.Warn("Unable to record end of member session", "channel", channelID, "user", userID, "error", err)
+	}
+}
+
+// recordChannelDeleted ends the session of a temporary channel and of all members still in it.
+func (d Discord) recordChannelDeleted(channelID string) {
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := d.db.endMemberSessions(ctx, channelID, "", now); err != nil {
+		slog.Warn("Unable to record end of member sessions", "channel", channelID, "error", err)
+		return
+	}
+	sessions, err := d.db.memberSessions(ctx, historyFilter{channelID: sql.NullString{String: channelID, Valid: true}})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		slog.Warn("Unable to query member sessions", "channel", channelID, "error", err)
+		return
+	}
+
+	var memberTime time.Duration
+	for _, session := range sessions {
+		memberTime += session.LeftAt.Time.Sub(session.JoinedAt)
+	}
+	err = d.db.endChannelSession(ctx, channelID, now, int64(memberTime.Seconds()))
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		// Channels created before history was recorded have no session.
+		slog.Warn("Unable to record end of channel session", "channel", channelID, "error", err)
+	}
+}
+
+// reconcileHistory starts the sessions of members in a temporary channel and ends those of members who are
+// gone, in case joins and leaves were missed while the bot was offline.
+func (d Discord) reconcileHistory(ctx context.Context, channelID string, states []*dgo.VoiceState) error {
+	present := make(map[string]struct{}, len(states))
+	for _, state := range states {
+		present[state.UserID] = struct{}{}
+		if state.Member != nil && state.Member.User != nil && state.Member.User.Bot {
+			continue
+		}
+		session := MemberSession{
+			GuildID:   state.GuildID,
+			ChannelID: channelID,
+			UserID:    state.UserID,
+			JoinedAt:  time.Now(),
+		}
+		if err := d.db.startMemberSession(ctx, session); err != nil {
+			return fmt.Errorf("unable to start member session: %w", err)
+		}
+	}
+
+	sessions, err := d.db.memberSessions(ctx, historyFilter{channelID: sql.NullString{String: channelID, Valid: true}})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to query member sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if _, ok := present[session.UserID]; ok || session.LeftAt.Valid {
+			continue
+		}
+		if err := d.db.endMemberSessions(ctx, channelID, session.UserID, time.Now()); err != nil {
+			return fmt.Errorf("unable to end member session: %w", err)
+		}
+	}
+	return nil
+}
+
+// creatorStats summarizes the temporary channels of a creator channel within a time window.
+type creatorStats struct {
+	creatorID string
+
+	// created counts the channels created within the window.
+	created int
+
+	// deleted counts the channels deleted within the window, lifetime is their total lifetime.
+	deleted  int
+	lifetime time.Duration
+
+	// peak is the highest number of members in a channel that existed within the window.
+	peak int
+
+	// memberTime is the time members spent in the channels within the window.
+	memberTime time.Duration
+}
+
+func (s *creatorStats) add(other creatorStats) {
+	s.created += other.created
+	s.deleted += other.deleted
+	s.lifetime += other.lifetime
+	s.peak = max(s.peak, other.peak)
+	s.memberTime += other.memberTime
+}
+
+func (s creatorStats) String() string {
+	averageLifetime := "none ended"
+	if s.deleted > 0 {
+		averageLifetime = formatDuration(s.lifetime / time.Duration(s.deleted))
+	}
+	return fmt.Sprintf("%v channels created, average lifetime %v, peak %v members, %v member time",
+		s.created, averageLifetime, s.peak, formatDuration(s.memberTime))
+}
+
+func (d Discord) handleTempVoiceStats(c *interactionContext) error {
+	options := c.optionMap()
+	windowName := "week"
+	if option, ok := options["window"]; ok {
+		windowName = option.StringValue()
+	}
+	window, ok := statsWindows[windowName]
+	if !ok {
+		return newCommandError("Unknown time window.")
+	}
+
+	stats, err := d.stats(context.Background(), c.i.GuildID, time.Now().Add(-window))
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Temporary channels in the last %v:\n", windowName))
+	if option, ok := options["creator"]; ok {
+		creatorID := option.StringValue()
+		i := slices.IndexFunc(stats, func(s creatorStats) bool { return s.creatorID == creatorID })
+		if i == -1 {
+			b.WriteString(fmt.Sprintf("<#%v>: no temporary channels\n", creatorID))
+		} else {
+			b.WriteString(fmt.Sprintf("<#%v>: %v\n", creatorID, stats[i]))
+		}
+		return c.text(b.String())
+	}
+
+	var total creatorStats
+	for _, s := range stats {
+		total.add(s)
+	}
+	b.WriteString(fmt.Sprintf("**Server**: %v\n", total))
+	for i, s := range stats {
+		if i == statsListLimit {
+			b.WriteString(fmt.Sprintf("and %v more creator channels\n", len(stats)-i))
+			break
+		}
+		if s.creatorID == "" {
+			b.WriteString(fmt.Sprintf("Without creator channel: %v\n", s))
+			continue
+		}
+		b.WriteString(fmt.Sprintf("<#%v>: %v\n", s.creatorID, s))
+	}
+
+	return c.text(b.String())
+}
+
+// stats summarizes the temporary channels of a guild per creator channel since a point in time,
+// the creator channels with the most created channels come first.
+func (d Discord) stats(ctx context.Context, guildID string, since time.Time) ([]creatorStats, error) {
+	filter := historyFilter{
+		guildID: sql.NullString{String: guildID, Valid: true},
+		since:   sql.NullTime{Time: since, Valid: true},
+	}
+	channelSessions, err := d.db.channelSessions(ctx, filter)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("unable to query channel sessions: %w", err)
+	}
+	memberSessions, err := d.db.memberSessions(ctx, filter)
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return nil, fmt.Errorf("unable to query member sessions: %w", err)
+	}
+
+	byCreator := make(map[string]*creatorStats)
+	creatorOf := make(map[string]string, len(channelSessions))
+	get := func(creatorID string) *creatorStats {
+		s, ok := byCreator[creatorID]
+		if !ok {
+			s = &creatorStats{creatorID: creatorID}
+			byCreator[creatorID] = s
+		}
+		return s
+	}
+
+	for _, session := range channelSessions {
+		creatorOf[session.ChannelID] = session.CreatorID
+		s := get(session.CreatorID)
+		if !session.CreatedAt.Before(since) {
+			s.created++
+		}
+		if session.DeletedAt.Valid {
+			s.deleted++
+			s.lifetime += session.DeletedAt.Time.Sub(session.CreatedAt)
+		}
+		s.peak = max(s.peak, session.PeakMembers)
+	}
+
+	now := time.Now()
+	for _, session := range memberSessions {
+		left := now
+		if session.LeftAt.Valid {
+			left = session.LeftAt.Time
+		}
+		joined := session.JoinedAt
+		if joined.Before(since) {
+			joined = since
+		}
+		if left.After(joined) {
+			get(creatorOf[session.ChannelID]).memberTime += left.Sub(joined)
+		}
+	}
+
+	stats := make([]creatorStats, 0, len(byCreator))
+	for _, s := range byCreator {
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b creatorStats) int {
+		return cmp.Or(cmp.Compare(b.created, a.created), cmp.Compare(a.creatorID, b.creatorID))
+	})
+	return stats, nil
+}
+
+// formatDuration formats a duration in hours and minutes.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%vm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%vh %vm", int(d.Hours()), int(d.Minutes())%60)
+}
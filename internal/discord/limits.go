@@ -0,0 +1,202 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+const (
+	// maxCreateCooldown is the longest cooldown between creating temporary channels, in seconds.
+	maxCreateCooldown = 60 * 60
+
+	// maxGuildChannels is the most channels Discord allows in a guild.
+	maxGuildChannels = 500
+)
+
+// Limit actions of guilds, which decide what happens to members who join a creator channel beyond a limit.
+const (
+	// limitActionMove moves members to a temporary channel they own, or disconnects them like
+	// limitActionDisconnect if they own none.
+	limitActionMove = "move"
+
+	// limitActionDisconnect disconnects members and explains why in a direct message.
+	limitActionDisconnect = "disconnect"
+)
+
+// createCooldowns remembers when members last created a temporary channel.
+type createCooldowns struct {
+	mu      sync.Mutex
+	created map[userKey]time.Time
+}
+
+func newCreateCooldowns() *createCooldowns {
+	return &createCooldowns{
+		created: make(map[userKey]time.Time),
+	}
+}
+
+// remaining returns how long a member has to wait before creating another temporary channel.
+func (c *createCooldowns) remaining(key userKey, cooldown time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	created, ok := c.created[key]
+	if !ok {
+		return 0
+	}
+	return max(cooldown-time.Since(created), 0)
+}
+
+// record remembers that a member created a temporary channel now and drops entries older than any cooldown.
+func (c *createCooldowns) record(key userKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for other, created := range c.created {
+		if now.Sub(created) > maxCreateCooldown*time.Second {
+			delete(c.created, other)
+		}
+	}
+	c.created[key] = now
+}
+
+// guildSettings returns the settings of a guild, which are the defaults if the guild is unknown.
+func (d Discord) guildSettings(ctx context.Context, guildID string) (GuildSettings, error) {
+	settings, err := d.db.guildSettings(ctx, guildID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return GuildSettings{GuildID: guildID, LimitAction: limitActionMove}, nil
+	}
+	if err != nil {
+		return GuildSettings{}, fmt.Errorf("unable to get guild settings: %w", err)
+	}
+	return settings, nil
+}
+
+// limitExceeded returns why a member may not create another temporary channel, or an empty string if they may.
+// ownedID is a temporary channel the member owns, if any.
+func (d Discord) limitExceeded(ctx context.Context, settings GuildSettings, userID string) (reason string, ownedID string, err error) {
+	if settings.CreateCooldown == 0 && settings.MaxOwnedChannels == 0 && settings.MaxChannels == 0 {
+		return "", "", nil
+	}
+
+	channels, err := d.db.temporaryChannels(ctx, temporaryChannelFilter{guildID: sql.NullString{String: settings.GuildID, Valid: true}})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return "", "", fmt.Errorf("unable to query temporary channels: %w", err)
+	}
+	owned := 0
+	for _, channel := range channels {
+		if channel.OwnerID == userID {
+			owned++
+			ownedID = channel.ID
+		}
+	}
+
+	cooldown := time.Duration(settings.CreateCooldown) * time.Second
+	if remaining := d.cooldowns.remaining(userKey{settings.GuildID, userID}, cooldown); remaining > 0 {
+		return fmt.Sprintf("you can create another temporary channel in %v", remaining.Round(time.Second)), ownedID, nil
+	}
+	if settings.MaxOwnedChannels > 0 && owned >= settings.MaxOwnedChannels {
+		return fmt.Sprintf("you can own at most %v temporary channels at once", settings.MaxOwnedChannels), ownedID, nil
+	}
+	if settings.MaxChannels > 0 && len(channels) >= settings.MaxChannels {
+		return fmt.Sprintf("the server has reached its limit of %v temporary channels", settings.MaxChannels), ownedID, nil
+	}
+	return "", ownedID, nil
+}
+
+// limitHit takes a member who hit a limit out of the creator channel according to the limit action of the guild.
+func (d Discord) limitHit(s *dgo.Session, e *dgo.VoiceState, settings GuildSettings, reason, ownedID string) error {
+	slog.Info("Member hit temporary channel limit", "guild_id", e.GuildID, "user", e.UserID, "reason", reason, "action", settings.LimitAction)
+
+	if settings.LimitAction == limitActionMove && ownedID != "" {
+		if err := s.GuildMemberMove(e.GuildID, e.UserID, &ownedID); err != nil {
+			return fmt.Errorf("unable to move member to owned temporary channel: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.GuildMemberMove(e.GuildID, e.UserID, nil); err != nil {
+		return fmt.Errorf("unable to disconnect member: %w", err)
+	}
+
+	guildName := "the server"
+	if guild, err := s.State.Guild(e.GuildID); err == nil {
+		guildName = guild.Name
+	}
+	dm, err := s.UserChannelCreate(e.UserID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(dm.ID, fmt.Sprintf("I did not create a temporary channel for you in %v, %v.", guildName, reason))
+	}
+	if err != nil {
+		slog.Warn("Unable to explain limit to member", "guild_id", e.GuildID, "user", e.UserID, "error", err)
+	}
+	return nil
+}
+
+func (d Discord) handleTempVoiceCreatorLimits(c *interactionContext) error {
+	options := c.optionMap()
+
+	ctx := context.Background()
+	settings, err := d.guildSettings(ctx, c.i.GuildID)
+	if err != nil {
+		return err
+	}
+
+	message := "Limits"
+	if len(options) > 0 {
+		if option, ok := options["cooldown"]; ok {
+			settings.CreateCooldown = int(option.IntValue())
+		}
+		if option, ok := options["max_owned"]; ok {
+			settings.MaxOwnedChannels = int(option.IntValue())
+		}
+		if option, ok := options["max_channels"]; ok {
+			settings.MaxChannels = int(option.IntValue())
+		}
+		if option, ok := options["action"]; ok {
+			settings.LimitAction = option.StringValue()
+		}
+
+		if err := d.db.ensureGuild(ctx, settings.GuildID); err != nil {
+			return fmt.Errorf("unable to create guild: %w", err)
+		}
+		if settings, err = d.db.updateGuildSettings(ctx, settings); err != nil {
+			return fmt.Errorf("unable to update guild settings: %w", err)
+		}
+		message = "Changed limits"
+	}
+
+	return c.text(fmt.Sprintf("%v of temporary channels:\n%v", message, describeLimits(settings)))
+}
+
+// describeLimits lists the limits of a guild, one per line.
+func describeLimits(settings GuildSettings) string {
+	limit := func(name string, value int, format string) string {
+		if value == 0 {
+			return fmt.Sprintf("%v: none\n", name)
+		}
+		return fmt.Sprintf("%v: "+format+"\n", name, value)
+	}
+
+	var b strings.Builder
+	b.WriteString(limit("Cooldown", settings.CreateCooldown, "%v seconds"))
+	b.WriteString(limit("Channels per member", settings.MaxOwnedChannels, "%v"))
+	b.WriteString(limit("Channels in this server", settings.MaxChannels, "%v"))
+	switch settings.LimitAction {
+	case limitActionDisconnect:
+		b.WriteString("When a limit is hit: disconnect and explain why\n")
+	default:
+		b.WriteString("When a limit is hit: move to an owned channel\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,525 @@
+package discord
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tombuente/omni/internal/apperrors"
+	"github.com/tombuente/omni/internal/database"
+)
+
+// MemoryDatabase is a Storage that keeps everything in memory, for tests and for
+// running the bot without Postgres. All state is lost when the process exits.
+type MemoryDatabase struct {
+	mu    *sync.Mutex
+	state *memoryState
+
+	// inTx is set if the MemoryDatabase was obtained through withTx, mu is held already.
+	inTx bool
+}
+
+type memoryState struct {
+	// guilds holds the time the bot joined each guild.
+	guilds        map[string]time.Time
+	guildSettings map[string]GuildSettings
+
+	creatorChannels   map[string]CreatorChannel
+	temporaryChannels map[string]TemporaryChannel
+	groups            map[int64]Group
+	lastGroupID       int64
+	userPreferences   map[userKey]UserPreferences
+	channelSessions   map[string]ChannelSession
+	memberSessions    []MemberSession
+}
+
+// userKey identifies a user within a guild.
+type userKey struct {
+	guildID string
+	userID  string
+}
+
+func MakeMemoryDatabase() MemoryDatabase {
+	return MemoryDatabase{
+		mu: &sync.Mutex{},
+		state: &memoryState{
+			guilds:            make(map[string]time.Time),
+			guildSettings:     make(map[string]GuildSettings),
+			creatorChannels:   make(map[string]CreatorChannel),
+			temporaryChannels: make(map[string]TemporaryChannel),
+			groups:            make(map[int64]Group),
+			userPreferences:   make(map[userKey]UserPreferences),
+			channelSessions:   make(map[string]ChannelSession),
+		},
+	}
+}
+
+// withTx holds the lock for the whole duration of fn and restores a snapshot of the
+// state if fn fails. Calling withTx on a transactional MemoryDatabase works like a savepoint.
+func (db MemoryDatabase) withTx(ctx context.Context, fn func(tx Storage) error) error {
+	defer db.lock()()
+
+	snapshot := db.state.clone()
+	if err := fn(MemoryDatabase{mu: db.mu, state: db.state, inTx: true}); err != nil {
+		*db.state = snapshot
+		return err
+	}
+	return nil
+}
+
+func (db MemoryDatabase) ensureGuild(ctx context.Context, id string) error {
+	defer db.lock()()
+
+	if _, ok := db.state.guilds[id]; !ok {
+		db.state.guilds[id] = time.Now()
+		db.state.guildSettings[id] = GuildSettings{GuildID: id, LimitAction: limitActionMove}
+	}
+	return nil
+}
+
+func (db MemoryDatabase) deleteGuild(ctx context.Context, id string) error {
+	defer db.lock()()
+
+	delete(db.state.guilds, id)
+	delete(db.state.guildSettings, id)
+	maps.DeleteFunc(db.state.creatorChannels, func(_ string, channel CreatorChannel) bool {
+		return channel.GuildID == id
+	})
+	maps.DeleteFunc(db.state.temporaryChannels, func(_ string, channel TemporaryChannel) bool {
+		return channel.GuildID == id
+	})
+	maps.DeleteFunc(db.state.groups, func(_ int64, group Group) bool {
+		return group.GuildID == id
+	})
+	maps.DeleteFunc(db.state.userPreferences, func(key userKey, _ UserPreferences) bool {
+		return key.guildID == id
+	})
+	maps.DeleteFunc(db.state.channelSessions, func(_ string, session ChannelSession) bool {
+		return session.GuildID == id
+	})
+	db.state.memberSessions = slices.DeleteFunc(db.state.memberSessions, func(session MemberSession) bool {
+		return session.GuildID == id
+	})
+	return nil
+}
+
+func (db MemoryDatabase) guildSettings(ctx context.Context, id string) (GuildSettings, error) {
+	defer db.lock()()
+
+	settings, ok := db.state.guildSettings[id]
+	if !ok {
+		return GuildSettings{}, apperrors.ErrNotFound
+	}
+	return settings, nil
+}
+
+func (db MemoryDatabase) updateGuildSettings(ctx context.Context, params GuildSettings) (GuildSettings, error) {
+	defer db.lock()()
+
+	if _, ok := db.state.guildSettings[params.GuildID]; !ok {
+		return GuildSettings{}, apperrors.ErrNotFound
+	}
+	db.state.guildSettings[params.GuildID] = params
+	return params, nil
+}
+
+func (db MemoryDatabase) creatorChannel(ctx context.Context, id string) (CreatorChannel, error) {
+	defer db.lock()()
+
+	channel, ok := db.state.creatorChannels[id]
+	if !ok {
+		return CreatorChannel{}, apperrors.ErrNotFound
+	}
+	return channel, nil
+}
+
+func (db MemoryDatabase) creatorChannels(ctx context.Context, filter creatorChannelFilter) ([]CreatorChannel, error) {
+	defer db.lock()()
+
+	var channels []CreatorChannel
+	for _, channel := range db.state.creatorChannels {
+		if filter.guildID.Valid && channel.GuildID != filter.guildID.String {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return sortedOrNotFound(channels, func(channel CreatorChannel) string { return channel.ID })
+}
+
+func (db MemoryDatabase) createCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error) {
+	defer db.lock()()
+
+	if _, ok := db.state.creatorChannels[params.ID]; ok {
+		return CreatorChannel{}, fmt.Errorf("creator channel %v already exists: %w", params.ID, apperrors.ErrConflict)
+	}
+	db.state.creatorChannels[params.ID] = params
+	return params, nil
+}
+
+func (db MemoryDatabase) updateCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error) {
+	defer db.lock()()
+
+	channel, ok := db.state.creatorChannels[params.ID]
+	if !ok || channel.GuildID != params.GuildID {
+		return CreatorChannel{}, apperrors.ErrNotFound
+	}
+	db.state.creatorChannels[params.ID] = params
+	return params, nil
+}
+
+func (db MemoryDatabase) deleteCreatorChannel(ctx context.Context, id string) error {
+	defer db.lock()()
+
+	if _, ok := db.state.creatorChannels[id]; !ok {
+		return apperrors.ErrNotFound
+	}
+	delete(db.state.creatorChannels, id)
+	return nil
+}
+
+func (db MemoryDatabase) temporaryChannel(ctx context.Context, id string) (TemporaryChannel, error) {
+	defer db.lock()()
+
+	channel, ok := db.state.temporaryChannels[id]
+	if !ok {
+		return TemporaryChannel{}, apperrors.ErrNotFound
+	}
+	return channel, nil
+}
+
+func (db MemoryDatabase) temporaryChannels(ctx context.Context, filter temporaryChannelFilter) ([]TemporaryChannel, error) {
+	defer db.lock()()
+
+	var channels []TemporaryChannel
+	for _, channel := range db.state.temporaryChannels {
+		if filter.guildID.Valid && channel.GuildID != filter.guildID.String {
+			continue
+		}
+		if filter.creatorID.Valid && channel.CreatorID != filter.creatorID.String {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return sortedOrNotFound(channels, func(channel TemporaryChannel) string { return channel.ID })
+}
+
+func (db MemoryDatabase) createTemporaryChannel(ctx context.Context, params TemporaryChannel) (TemporaryChannel, error) {
+	defer db.lock()()
+
+	if _, ok := db.state.temporaryChannels[params.ID]; ok {
+		return TemporaryChannel{}, fmt.Errorf("temporary channel %v already exists: %w", params.ID, apperrors.ErrConflict)
+	}
+	db.state.temporaryChannels[params.ID] = params
+	return params, nil
+}
+
+func (db MemoryDatabase) deleteTemporaryChannel(ctx context.Context, id string) error {
+	defer db.lock()()
+
+	if _, ok := db.state.temporaryChannels[id]; !ok {
+		return apperrors.ErrNotFound
+	}
+	delete(db.state.temporaryChannels, id)
+	return nil
+}
+
+func (db MemoryDatabase) setTemporaryChannelDeleteAt(ctx context.Context, id string, deleteAt sql.NullTime) error {
+	defer db.lock()()
+
+	channel, ok := db.state.temporaryChannels[id]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+	channel.DeleteAt = deleteAt
+	db.state.temporaryChannels[id] = channel
+	return nil
+}
+
+func (db MemoryDatabase) setTemporaryChannelWaitingRoom(ctx context.Context, id, waitingRoomID string) error {
+	defer db.lock()()
+
+	channel, ok := db.state.temporaryChannels[id]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+	channel.WaitingRoomID = waitingRoomID
+	db.state.temporaryChannels[id] = channel
+	return nil
+}
+
+func (db MemoryDatabase) setTemporaryChannelBaseName(ctx context.Context, id, baseName string) error {
+	defer db.lock()()
+
+	channel, ok := db.state.temporaryChannels[id]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+	channel.BaseName = baseName
+	db.state.temporaryChannels[id] = channel
+	return nil
+}
+
+func (db MemoryDatabase) transferTemporaryChannel(ctx context.Context, id, fromOwnerID, toOwnerID string) error {
+	defer db.lock()()
+
+	channel, ok := db.state.temporaryChannels[id]
+	if !ok || channel.OwnerID != fromOwnerID {
+		return apperrors.ErrConflict
+	}
+	channel.OwnerID = toOwnerID
+	db.state.temporaryChannels[id] = channel
+	return nil
+}
+
+func (db MemoryDatabase) userPreferences(ctx context.Context, guildID, userID string) (UserPreferences, error) {
+	defer db.lock()()
+
+	preferences, ok := db.state.userPreferences[userKey{guildID: guildID, userID: userID}]
+	if !ok {
+		return UserPreferences{}, apperrors.ErrNotFound
+	}
+	return preferences, nil
+}
+
+func (db MemoryDatabase) saveUserPreferences(ctx context.Context, params UserPreferences) (UserPreferences, error) {
+	defer db.lock()()
+
+	db.state.userPreferences[userKey{guildID: params.GuildID, userID: params.UserID}] = params
+	return params, nil
+}
+
+func (db MemoryDatabase) createChannelSession(ctx context.Context, params ChannelSession) error {
+	defer db.lock()()
+
+	if _, ok := db.state.channelSessions[params.ChannelID]; ok {
+		return fmt.Errorf("channel session %v already exists: %w", params.ChannelID, apperrors.ErrConflict)
+	}
+	db.state.channelSessions[params.ChannelID] = ChannelSession{
+		ChannelID: params.ChannelID,
+		GuildID:   params.GuildID,
+		CreatorID: params.CreatorID,
+		OwnerID:   params.OwnerID,
+		CreatedAt: params.CreatedAt,
+	}
+	return nil
+}
+
+func (db MemoryDatabase) raiseChannelSessionPeak(ctx context.Context, channelID string, members int) error {
+	defer db.lock()()
+
+	session, ok := db.state.channelSessions[channelID]
+	if !ok {
+		return apperrors.ErrNotFound
+	}
+	session.PeakMembers = max(session.PeakMembers, members)
+	db.state.channelSessions[channelID] = session
+	return nil
+}
+
+func (db MemoryDatabase) endChannelSession(ctx context.Context, channelID string, deletedAt time.Time, memberSeconds int64) error {
+	defer db.lock()()
+
+	session, ok := db.state.channelSessions[channelID]
+	if !ok || session.DeletedAt.Valid {
+		return apperrors.ErrNotFound
+	}
+	session.DeletedAt = sql.NullTime{Time: deletedAt, Valid: true}
+	session.MemberSeconds = memberSeconds
+	db.state.channelSessions[channelID] = session
+	return nil
+}
+
+func (db MemoryDatabase) channelSessions(ctx context.Context, filter historyFilter) ([]ChannelSession, error) {
+	defer db.lock()()
+
+	var sessions []ChannelSession
+	for _, session := range db.state.channelSessions {
+		if filter.guildID.Valid && session.GuildID != filter.guildID.String {
+			continue
+		}
+		if filter.channelID.Valid && session.ChannelID != filter.channelID.String {
+			continue
+		}
+		if filter.since.Valid && session.DeletedAt.Valid && session.DeletedAt.Time.Before(filter.since.Time) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sortedOrNotFound(sessions, func(session ChannelSession) string { return session.ChannelID })
+}
+
+func (db MemoryDatabase) startMemberSession(ctx context.Context, params MemberSession) error {
+	defer db.lock()()
+
+	for _, session := range db.state.memberSessions {
+		if session.ChannelID == params.ChannelID && session.UserID == params.UserID && !session.LeftAt.Valid {
+			return nil
+		}
+	}
+	db.state.memberSessions = append(db.state.memberSessions, MemberSession{
+		GuildID:   params.GuildID,
+		ChannelID: params.ChannelID,
+		UserID:    params.UserID,
+		JoinedAt:  params.JoinedAt,
+	})
+	return nil
+}
+
+func (db MemoryDatabase) endMemberSessions(ctx context.Context, channelID, userID string, leftAt time.Time) error {
+	defer db.lock()()
+
+	for i, session := range db.state.memberSessions {
+		if session.ChannelID == channelID && (userID == "" || session.UserID == userID) && !session.LeftAt.Valid {
+			db.state.memberSessions[i].LeftAt = sql.NullTime{Time: leftAt, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (db MemoryDatabase) memberSessions(ctx context.Context, filter historyFilter) ([]MemberSession, error) {
+	defer db.lock()()
+
+	var sessions []MemberSession
+	for _, session := range db.state.memberSessions {
+		if filter.guildID.Valid && session.GuildID != filter.guildID.String {
+			continue
+		}
+		if filter.channelID.Valid && session.ChannelID != filter.channelID.String {
+			continue
+		}
+		if filter.since.Valid && session.LeftAt.Valid && session.LeftAt.Time.Before(filter.since.Time) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sortedOrNotFound(sessions, func(session MemberSession) int64 { return session.JoinedAt.UnixNano() })
+}
+
+func (db MemoryDatabase) pruneHistory(ctx context.Context, before time.Time) error {
+	defer db.lock()()
+
+	maps.DeleteFunc(db.state.channelSessions, func(_ string, session ChannelSession) bool {
+		return session.DeletedAt.Valid && session.DeletedAt.Time.Before(before)
+	})
+	db.state.memberSessions = slices.DeleteFunc(db.state.memberSessions, func(session MemberSession) bool {
+		return session.LeftAt.Valid && session.LeftAt.Time.Before(before)
+	})
+	return nil
+}
+
+func (db MemoryDatabase) group(ctx context.Context, id int64) (Group, error) {
+	defer db.lock()()
+
+	group, ok := db.state.groups[id]
+	if !ok {
+		return Group{}, apperrors.ErrNotFound
+	}
+	return group, nil
+}
+
+func (db MemoryDatabase) groups(ctx context.Context, filter GroupFilter) ([]Group, error) {
+	defer db.lock()()
+
+	var groups []Group
+	for _, group := range db.state.groups {
+		if filter.guildID.Valid && group.GuildID != filter.guildID.String {
+			continue
+		}
+		if filter.name.Valid && group.Name != filter.name.String {
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return sortedOrNotFound(groups, func(group Group) int64 { return group.ID })
+}
+
+func (db MemoryDatabase) groupsPage(ctx context.Context, filter GroupFilter, cursor database.Cursor, limit int) (database.Page[Group], error) {
+	after, err := cursor.Key()
+	if err != nil {
+		return database.Page[Group]{}, err
+	}
+	var afterID int64
+	if after.Valid {
+		afterID, err = strconv.ParseInt(after.String, 10, 64)
+		if err != nil {
+			return database.Page[Group]{}, fmt.Errorf("malformatted cursor: %w", apperrors.ErrInvalid)
+		}
+	}
+
+	groups, err := db.groups(ctx, filter)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return database.Page[Group]{}, nil
+	} else if err != nil {
+		return database.Page[Group]{}, err
+	}
+
+	var is []Group
+	for _, group := range groups {
+		if group.ID > afterID && len(is) <= limit {
+			is = append(is, group)
+		}
+	}
+	return database.NewPage(is, limit, groupKey), nil
+}
+
+func (db MemoryDatabase) createGroup(ctx context.Context, params GroupParams) (Group, error) {
+	defer db.lock()()
+
+	for _, group := range db.state.groups {
+		if group.GuildID == params.guildID && group.Name == params.name {
+			return Group{}, fmt.Errorf("group %q already exists in guild %v: %w", params.name, params.guildID, apperrors.ErrConflict)
+		}
+	}
+
+	db.state.lastGroupID++
+	group := Group{
+		ID:      db.state.lastGroupID,
+		Name:    params.name,
+		GuildID: params.guildID,
+	}
+	db.state.groups[group.ID] = group
+	return group, nil
+}
+
+// lock acquires the mutex unless it is held by the surrounding transaction
+// and returns the matching unlock func.
+func (db MemoryDatabase) lock() func() {
+	if db.inTx {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+func (s *memoryState) clone() memoryState {
+	return memoryState{
+		guilds:            maps.Clone(s.guilds),
+		guildSettings:     maps.Clone(s.guildSettings),
+		creatorChannels:   maps.Clone(s.creatorChannels),
+		temporaryChannels: maps.Clone(s.temporaryChannels),
+		groups:            maps.Clone(s.groups),
+		lastGroupID:       s.lastGroupID,
+		userPreferences:   maps.Clone(s.userPreferences),
+		channelSessions:   maps.Clone(s.channelSessions),
+		memberSessions:    slices.Clone(s.memberSessions),
+	}
+}
+
+// sortedOrNotFound sorts records by key to give listings a stable order and
+// mirrors database.Many by returning apperrors.ErrNotFound if there are none.
+func sortedOrNotFound[T any, K cmp.Ordered](records []T, key func(T) K) ([]T, error) {
+	if len(records) == 0 {
+		return nil, apperrors.ErrNotFound
+	}
+	slices.SortFunc(records, func(a, b T) int {
+		return cmp.Compare(key(a), key(b))
+	})
+	return records, nil
+}
@@ -0,0 +1,110 @@
+package discord
+
+import (
+	"strconv"
+	"strings"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultNameTemplate names temporary channels after their owner.
+	defaultNameTemplate = "{nickname}"
+
+	// maxChannelNameLength is the longest channel name Discord accepts, in characters.
+	maxChannelNameLength = 100
+)
+
+// nameData holds the values of the placeholders of a name template.
+type nameData struct {
+	username string
+	nickname string
+	counter  int
+	creator  string
+	activity string
+}
+
+// renderName fills in the placeholders of a name template:
+//
+//	{username}  user name of the owner
+//	{nickname}  nickname of the owner, or their display name if they have none
+//	{counter}   number of the channel among the temporary channels of its creator
+//	{creator}   name of the creator channel
+//	{activity}  game or activity of the owner, empty if unknown
+//
+// Runs of whitespace left by empty placeholders are collapsed. The user name is used
+// if nothing remains.
+func renderName(template string, data nameData) string {
+	if template == "" {
+		template = defaultNameTemplate
+	}
+
+	replacer := strings.NewReplacer(
+		"{username}", data.username,
+		"{nickname}", data.nickname,
+		"{counter}", strconv.Itoa(data.counter),
+		"{creator}", data.creator,
+		"{activity}", data.activity,
+	)
+	name := strings.Join(strings.Fields(replacer.Replace(template)), " ")
+	if name == "" {
+		name = data.username
+	}
+
+	if runes := []rune(name); len(runes) > maxChannelNameLength {
+		name = string(runes[:maxChannelNameLength])
+	}
+	return name
+}
+
+// newNameData collects the placeholder values for a temporary channel of member created from creator.
+func newNameData(s *dgo.Session, member *dgo.Member, creator *dgo.Channel, counter int) nameData {
+	nickname := member.DisplayName()
+	if nickname == "" {
+		nickname = member.User.Username
+	}
+
+	return nameData{
+		username: member.User.Username,
+		nickname: nickname,
+		counter:  counter,
+		creator:  creator.Name,
+		activity: memberActivity(s, creator.GuildID, member.User.ID),
+	}
+}
+
+// memberActivity returns the name of what a member is doing, custom statuses aside.
+// Presences are only known to the state cache if the presence intent is enabled.
+func memberActivity(s *dgo.Session, guildID, userID string) string {
+	presence, err := s.State.Presence(guildID, userID)
+	if err != nil {
+		return ""
+	}
+
+	s.State.RLock()
+	defer s.State.RUnlock()
+
+	for _, activity := range presence.Activities {
+		if activity.Type != dgo.ActivityTypeCustom {
+			return activity.Name
+		}
+	}
+	return ""
+}
+
+// freeNumber returns the lowest positive number not used by any of channels, so that
+// numbers of deleted channels are reused.
+func freeNumber(channels []TemporaryChannel) int {
+	used := make(map[int]struct{}, len(channels))
+	for _, channel := range channels {
+		used[channel.Number] = struct{}{}
+	}
+
+	number := 1
+	for {
+		if _, ok := used[number]; !ok {
+			return number
+		}
+		number++
+	}
+}
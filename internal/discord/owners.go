@@ -0,0 +1,171 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// Owner policies of creator channels, which choose the new owner of a temporary channel when its owner leaves.
+const (
+	// ownerPolicyLongest passes the channel to the member who has been in it the longest.
+	ownerPolicyLongest = "longest"
+
+	// ownerPolicyRandom passes the channel to a random member.
+	ownerPolicyRandom = "random"
+
+	// ownerPolicyNone leaves the channel without owner until a member claims it.
+	ownerPolicyNone = "none"
+)
+
+// memberJoins remembers when members joined temporary channels, to find the longest present member.
+// Members present before a restart count as joined when reconcileGuild first saw them.
+type memberJoins struct {
+	mu     sync.Mutex
+	joined map[string]map[string]time.Time
+}
+
+func newMemberJoins() *memberJoins {
+	return &memberJoins{
+		joined: make(map[string]map[string]time.Time),
+	}
+}
+
+// add records that a member joined a channel at t unless a join is recorded already.
+func (j *memberJoins) add(channelID, userID string, t time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	members, ok := j.joined[channelID]
+	if !ok {
+		members = make(map[string]time.Time)
+		j.joined[channelID] = members
+	}
+	if _, ok := members[userID]; !ok {
+		members[userID] = t
+	}
+}
+
+func (j *memberJoins) remove(channelID, userID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.joined[channelID], userID)
+	if len(j.joined[channelID]) == 0 {
+		delete(j.joined, channelID)
+	}
+}
+
+func (j *memberJoins) forget(channelID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.joined, channelID)
+}
+
+// longest returns the user of userIDs who joined channelID first. Users without a recorded join come last.
+func (j *memberJoins) longest(channelID string, userIDs []string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var longest string
+	var longestJoined time.Time
+	for _, userID := range userIDs {
+		joined, ok := j.joined[channelID][userID]
+		if longest == "" || ok && (longestJoined.IsZero() || joined.Before(longestJoined)) {
+			longest, longestJoined = userID, joined
+		}
+	}
+	return longest
+}
+
+// ownerLeft passes a temporary channel whose owner left to another member according to the owner policy
+// of its creator channel and announces the new owner in the text chat of the channel.
+func (d Discord) ownerLeft(ctx context.Context, s *dgo.Session, channel TemporaryChannel) error {
+	policy, err := d.ownerPolicy(ctx, channel)
+	if err != nil {
+		return err
+	}
+
+	var ownerID string
+	candidates := channelMembers(s, channel.GuildID, channel.ID, channel.OwnerID)
+	if len(candidates) > 0 {
+		switch policy {
+		case ownerPolicyNone:
+		case ownerPolicyRandom:
+			ownerID = candidates[rand.IntN(len(candidates))]
+		default:
+			ownerID = d.joins.longest(channel.ID, candidates)
+		}
+	}
+
+	err = d.transferOwnership(ctx, s, channel, ownerID)
+	if errors.Is(err, apperrors.ErrConflict) {
+		// Somebody claimed the channel in the meantime.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Owner left temporary channel", "guild_id", channel.GuildID, "channel", channel.ID, "previous_owner", channel.OwnerID, "owner", ownerID, "policy", policy)
+
+	message := &dgo.MessageSend{
+		Content:         fmt.Sprintf("<@%v> left, <@%v> is the new owner of the channel.", channel.OwnerID, ownerID),
+		AllowedMentions: &dgo.MessageAllowedMentions{Users: []string{ownerID}},
+	}
+	if ownerID == "" {
+		message.Content = fmt.Sprintf("<@%v> left, the channel has no owner now. Use `/tempvoice claim` to take it over.", channel.OwnerID)
+		message.AllowedMentions = &dgo.MessageAllowedMentions{}
+	}
+	if _, err := s.ChannelMessageSendComplex(channel.ID, message); err != nil {
+		slog.Warn("Unable to announce new owner", "channel", channel.ID, "error", err)
+	}
+	return nil
+}
+
+// ownerPolicy returns the owner policy of the creator channel of a temporary channel.
+func (d Discord) ownerPolicy(ctx context.Context, channel TemporaryChannel) (string, error) {
+	if channel.CreatorID == "" {
+		return ownerPolicyLongest, nil
+	}
+
+	creator, err := d.db.creatorChannel(ctx, channel.CreatorID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// The creator channel was deleted since.
+		return ownerPolicyLongest, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to get creator channel: %w", err)
+	}
+	return creator.OwnerPolicy, nil
+}
+
+// channelMembers returns the users in a voice channel except for bots and excludedID.
+func channelMembers(s *dgo.Session, guildID, channelID, excludedID string) []string {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+
+	s.State.RLock()
+	defer s.State.RUnlock()
+
+	var userIDs []string
+	for _, state := range guild.VoiceStates {
+		if state.ChannelID != channelID || state.UserID == excludedID {
+			continue
+		}
+		if state.Member != nil && state.Member.User != nil && state.Member.User.Bot {
+			continue
+		}
+		userIDs = append(userIDs, state.UserID)
+	}
+	return userIDs
+}
@@ -0,0 +1,146 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// panelCustomID is the handler name in the custom IDs of control panel components.
+const panelCustomID = "panel"
+
+// postControlPanel posts the buttons controlling a temporary channel to the text chat of the channel.
+func postControlPanel(s *dgo.Session, channelID, ownerID string) error {
+	button := func(label, emoji, action string) dgo.Button {
+		return dgo.Button{
+			Label:    label,
+			Style:    dgo.SecondaryButton,
+			Emoji:    &dgo.ComponentEmoji{Name: emoji},
+			CustomID: customID(panelCustomID, action),
+		}
+	}
+
+	_, err := s.ChannelMessageSendComplex(channelID, &dgo.MessageSend{
+		Content: fmt.Sprintf("<@%v>, this is your channel. Use the buttons below or `/tempvoice` to manage it.", ownerID),
+		Components: []dgo.MessageComponent{
+			dgo.ActionsRow{Components: []dgo.MessageComponent{
+				button("Lock", "🔒", "lock"),
+				button("Unlock", "🔓", "unlock"),
+				button("Hide", "🙈", "hide"),
+				button("Unhide", "👀", "unhide"),
+			}},
+			dgo.ActionsRow{Components: []dgo.MessageComponent{
+				button("Limit", "👥", "limit"),
+				button("Rename", "✏️", "rename"),
+				button("Kick", "👢", "kick"),
+				button("Transfer", "👑", "transfer"),
+			}},
+		},
+		AllowedMentions: &dgo.MessageAllowedMentions{Users: []string{ownerID}},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to send control panel: %w", err)
+	}
+	return nil
+}
+
+// handlePanel handles the components of control panels and the modals and select menus they open.
+// Panels are posted in the text chat of their channel, so the channel of the interaction is the one to control.
+func (d Discord) handlePanel(c *interactionContext) error {
+	if len(c.args) == 0 {
+		return errNoHandler
+	}
+
+	channel, err := d.panelChannel(c)
+	if err != nil {
+		return err
+	}
+
+	switch c.args[0] {
+	case "lock":
+		return d.changeEveryone(c, channel, overwriteChange{deny: dgo.PermissionVoiceConnect}, func(p *UserPreferences) { p.Locked = true }, "Locked the channel.")
+	case "unlock":
+		return d.changeEveryone(c, channel, overwriteChange{inherit: dgo.PermissionVoiceConnect}, func(p *UserPreferences) { p.Locked = false }, "Unlocked the channel.")
+	case "hide":
+		return d.changeEveryone(c, channel, overwriteChange{deny: dgo.PermissionViewChannel}, func(p *UserPreferences) { p.Hidden = true }, "Hid the channel.")
+	case "unhide":
+		return d.changeEveryone(c, channel, overwriteChange{inherit: dgo.PermissionViewChannel}, func(p *UserPreferences) { p.Hidden = false }, "The channel is visible again.")
+	case "limit":
+		return c.modal(customID(panelCustomID, "limit_submit"), "User limit", textInput("limit", "Maximum number of users, 0 for no limit", 2))
+	case "limit_submit":
+		limit, err := strconv.Atoi(strings.TrimSpace(c.modalValue("limit")))
+		if err != nil || limit < 0 || limit > maxUserLimit {
+			return newCommandError(fmt.Sprintf("The user limit must be a number from 0 to %v.", maxUserLimit))
+		}
+		return d.limitTemporaryChannel(c, channel, limit)
+	case "rename":
+		return c.modal(customID(panelCustomID, "rename_submit"), "Rename channel", textInput("name", "New name", maxChannelNameLength))
+	case "rename_submit":
+		name := strings.TrimSpace(c.modalValue("name"))
+		if name == "" {
+			return newCommandError("The name must not be empty.")
+		}
+		return d.renameTemporaryChannel(c, channel, name)
+	case "kick":
+		return c.components("Who should be disconnected and kept out?", userSelect(customID(panelCustomID, "kick_select")))
+	case "kick_select":
+		return d.rejectUser(c, channel, selectedValue(c))
+	case "transfer":
+		return c.components("Who should own the channel?", userSelect(customID(panelCustomID, "transfer_select")))
+	case "transfer_select":
+		return d.transferTemporaryChannel(c, channel, selectedValue(c))
+	}
+	return errNoHandler
+}
+
+// panelChannel returns the temporary channel a panel interaction happened in, provided that the user owns it.
+func (d Discord) panelChannel(c *interactionContext) (TemporaryChannel, error) {
+	channel, err := d.db.temporaryChannel(context.Background(), c.i.ChannelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return TemporaryChannel{}, newCommandError("This is not a temporary channel anymore.").WithErr(err)
+	}
+	if err != nil {
+		return TemporaryChannel{}, fmt.Errorf("unable to get temporary channel: %w", err)
+	}
+
+	if err := requireOwner(c, channel); err != nil {
+		return TemporaryChannel{}, err
+	}
+	return channel, nil
+}
+
+func textInput(customID, label string, maxLength int) dgo.ActionsRow {
+	return dgo.ActionsRow{Components: []dgo.MessageComponent{
+		dgo.TextInput{
+			CustomID:  customID,
+			Label:     label,
+			Style:     dgo.TextInputShort,
+			Required:  true,
+			MaxLength: maxLength,
+		},
+	}}
+}
+
+func userSelect(customID string) dgo.ActionsRow {
+	return dgo.ActionsRow{Components: []dgo.MessageComponent{
+		dgo.SelectMenu{
+			MenuType:  dgo.UserSelectMenu,
+			CustomID:  customID,
+			MaxValues: 1,
+		},
+	}}
+}
+
+// selectedValue returns the first value chosen in a select menu.
+func selectedValue(c *interactionContext) string {
+	values := c.i.MessageComponentData().Values
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,152 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// preferences returns the preferences of a user, which are empty if none were saved yet.
+func (d Discord) preferences(ctx context.Context, guildID, userID string) (UserPreferences, error) {
+	preferences, err := d.db.userPreferences(ctx, guildID, userID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return UserPreferences{GuildID: guildID, UserID: userID}, nil
+	}
+	if err != nil {
+		return UserPreferences{}, fmt.Errorf("unable to get user preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+// rememberPreferences applies update to the preferences of a user unless they opted out.
+// Failures are logged only, the change to the channel itself already succeeded.
+func (d Discord) rememberPreferences(guildID, userID string, update func(p *UserPreferences)) {
+	ctx := context.Background()
+
+	preferences, err := d.preferences(ctx, guildID, userID)
+	if err != nil {
+		slog.Warn("Unable to remember user preferences", "guild_id", guildID, "user", userID, "error", err)
+		return
+	}
+	if preferences.OptedOut {
+		return
+	}
+
+	update(&preferences)
+	if _, err := d.db.saveUserPreferences(ctx, preferences); err != nil {
+		slog.Warn("Unable to remember user preferences", "guild_id", guildID, "user", userID, "error", err)
+	}
+}
+
+// applyPreferences changes how a temporary channel is created according to the preferences of its owner.
+func applyPreferences(data *voiceChannelCreateData, preferences UserPreferences) {
+	if preferences.OptedOut {
+		return
+	}
+
+	if preferences.Name.Valid {
+		data.Name = preferences.Name.String
+	}
+	if preferences.UserLimit.Valid {
+		data.UserLimit = int(preferences.UserLimit.Int64)
+	}
+
+	var everyone overwriteChange
+	if preferences.Locked {
+		everyone.deny |= dgo.PermissionVoiceConnect
+	}
+	if preferences.Hidden {
+		everyone.deny |= dgo.PermissionViewChannel
+	}
+	// The ID of @everyone is the guild ID.
+	changeOverwrite(&data.PermissionOverwrites, preferences.GuildID, dgo.PermissionOverwriteTypeRole, everyone)
+
+	for _, roleID := range splitIDs(preferences.PermittedRoleIDs) {
+		changeOverwrite(&data.PermissionOverwrites, roleID, dgo.PermissionOverwriteTypeRole, overwriteChange{allow: ownerPermissions})
+	}
+	for _, userID := range splitIDs(preferences.PermittedUserIDs) {
+		changeOverwrite(&data.PermissionOverwrites, userID, dgo.PermissionOverwriteTypeMember, overwriteChange{allow: ownerPermissions})
+	}
+	for _, userID := range splitIDs(preferences.RejectedUserIDs) {
+		if userID != preferences.UserID {
+			changeOverwrite(&data.PermissionOverwrites, userID, dgo.PermissionOverwriteTypeMember, overwriteChange{deny: ownerPermissions})
+		}
+	}
+}
+
+func (d Discord) handleTempVoiceReset(c *interactionContext) error {
+	ctx := context.Background()
+
+	preferences, err := d.preferences(ctx, c.i.GuildID, c.userID())
+	if err != nil {
+		return err
+	}
+
+	preferences = UserPreferences{
+		GuildID:  preferences.GuildID,
+		UserID:   preferences.UserID,
+		OptedOut: preferences.OptedOut,
+	}
+	if _, err := d.db.saveUserPreferences(ctx, preferences); err != nil {
+		return fmt.Errorf("unable to reset user preferences: %w", err)
+	}
+
+	return c.text("Forgot the settings of your temporary channels, the next one starts fresh.")
+}
+
+func (d Discord) handleTempVoiceRemember(c *interactionContext) error {
+	enabled := c.optionMap()["enabled"].BoolValue() // required
+
+	// Opting out also forgets what was remembered so far.
+	preferences := UserPreferences{
+		GuildID:  c.i.GuildID,
+		UserID:   c.userID(),
+		OptedOut: !enabled,
+	}
+	if enabled {
+		var err error
+		if preferences, err = d.preferences(context.Background(), c.i.GuildID, c.userID()); err != nil {
+			return err
+		}
+		preferences.OptedOut = false
+	}
+	if _, err := d.db.saveUserPreferences(context.Background(), preferences); err != nil {
+		return fmt.Errorf("unable to save user preferences: %w", err)
+	}
+
+	if enabled {
+		return c.text("The settings of your temporary channels will be remembered.")
+	}
+	return c.text("The settings of your temporary channels will not be remembered anymore.")
+}
+
+// splitIDs returns the IDs of a comma separated list.
+func splitIDs(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+// addID adds id to a comma separated list unless it is contained already.
+func addID(list, id string) string {
+	ids := splitIDs(list)
+	if slices.Contains(ids, id) {
+		return list
+	}
+	return strings.Join(append(ids, id), ",")
+}
+
+// removeID removes id from a comma separated list.
+func removeID(list, id string) string {
+	ids := slices.DeleteFunc(splitIDs(list), func(other string) bool {
+		return other == id
+	})
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,240 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+const (
+	// reconcileInterval is how often tracked channels are compared with the guild state cache.
+	reconcileInterval = 10 * time.Minute
+
+	// reconcileMinAge protects channels that were just created, and whose members may
+	// not have been moved in yet, from being deleted as empty.
+	reconcileMinAge = time.Minute
+)
+
+// guildSnapshot is a consistent copy of the parts of a cached guild needed for reconciliation.
+type guildSnapshot struct {
+	channels map[string]struct{}
+
+	// voiceStates holds the voice states per channel ID.
+	voiceStates map[string][]*dgo.VoiceState
+}
+
+// reconcilePeriodically reconciles all guilds every reconcileInterval until ctx is done.
+func (d Discord) reconcilePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.session.State.RLock()
+		guildIDs := make([]string, 0, len(d.session.State.Guilds))
+		for _, guild := range d.session.State.Guilds {
+			guildIDs = append(guildIDs, guild.ID)
+		}
+		d.session.State.RUnlock()
+
+		for _, guildID := range guildIDs {
+			if err := d.reconcileGuild(ctx, d.session, guildID); err != nil {
+				slog.Error("Unable to reconcile guild", "guild_id", guildID, "error", err)
+			}
+		}
+
+		if err := d.db.pruneHistory(ctx, time.Now().Add(-historyRetention)); err != nil {
+			slog.Error("Unable to prune history", "error", err)
+		}
+	}
+}
+
+// reconcileGuild brings the tracked channels of a guild in line with the guild state cache, which
+// may have diverged while the bot was offline. Rows of channels that no longer exist are dropped,
+// empty temporary channels are scheduled for deletion, pending deletions of occupied ones are cancelled,
+// occupied ones whose owner left get a new owner and members waiting in creator channels get their channel.
+func (d Discord) reconcileGuild(ctx context.Context, s *dgo.Session, guildID string) error {
+	guild, err := snapshotGuild(s, guildID)
+	if err != nil {
+		return err
+	}
+	guildFilter := sql.NullString{String: guildID, Valid: true}
+
+	creatorChannels, err := d.db.creatorChannels(ctx, creatorChannelFilter{guildID: guildFilter})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to query creator channels: %w", err)
+	}
+	for _, channel := range creatorChannels {
+		if _, ok := guild.channels[channel.ID]; !ok {
+			slog.Info("Dropping creator channel that no longer exists", "guild_id", guildID, "channel", channel.ID)
+			if err := d.forgetCreatorChannel(ctx, guildID, channel.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, state := range guild.voiceStates[channel.ID] {
+			// Queued behind the voice state updates of the guild, which may have given the member a channel already.
+			d.events.push(guildID, func() {
+				if d.cooldowns.remaining(userKey{guildID, state.UserID}, reconcileMinAge) > 0 {
+					return
+				}
+				if current, err := s.State.VoiceState(guildID, state.UserID); err != nil || current.ChannelID != channel.ID {
+					return
+				}
+
+				slog.Info("Creating temporary channel for member who joined while offline", "guild_id", guildID, "user", state.UserID)
+				if err := d.joinedCreatorChannel(s, state); err != nil {
+					slog.Warn("Unable to create temporary channel", "guild_id", guildID, "user", state.UserID, "error", err)
+				}
+			})
+		}
+	}
+
+	temporaryChannels, err := d.db.temporaryChannels(ctx, temporaryChannelFilter{guildID: guildFilter})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to query temporary channels: %w", err)
+	}
+	for _, channel := range temporaryChannels {
+		if err := d.reconcileTemporaryChannel(ctx, s, guildID, channel.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileTemporaryChannel reconciles a temporary channel against the current guild state cache while
+// holding its lock, so that its deletion is not decided on against a stale snapshot.
+func (d Discord) reconcileTemporaryChannel(ctx context.Context, s *dgo.Session, guildID, channelID string) error {
+	unlock := d.locks.lock(channelID)
+	defer unlock()
+
+	channel, err := d.db.temporaryChannel(ctx, channelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get temporary channel: %w", err)
+	}
+	guild, err := snapshotGuild(s, guildID)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := guild.channels[channel.ID]; !ok {
+		slog.Info("Dropping temporary channel that no longer exists", "guild_id", guildID, "channel", channel.ID)
+		if err := d.removeWaitingRoom(ctx, s, channel); err != nil {
+			slog.Warn("Unable to remove waiting room", "channel", channel.ID, "error", err)
+		}
+		return d.forgetTemporaryChannel(ctx, guildID, channel.ID)
+	}
+	if _, ok := guild.channels[channel.WaitingRoomID]; channel.WaitingRoomID != "" && !ok {
+		slog.Info("Dropping waiting room that no longer exists", "guild_id", guildID, "channel", channel.WaitingRoomID)
+		if err := d.forgetWaitingRoom(ctx, guildID, channel.WaitingRoomID, channel.ID); err != nil {
+			return err
+		}
+		channel.WaitingRoomID = ""
+	}
+	if err := d.reconcileHistory(ctx, channel.ID, guild.voiceStates[channel.ID]); err != nil {
+		slog.Warn("Unable to reconcile history", "channel", channel.ID, "error", err)
+	}
+
+	if states := guild.voiceStates[channel.ID]; len(states) > 0 {
+		if channel.DeleteAt.Valid {
+			if err := d.cancelDeletion(ctx, channel.ID); err != nil {
+				return err
+			}
+		}
+
+		ownerPresent := false
+		for _, state := range states {
+			d.joins.add(channel.ID, state.UserID, time.Now())
+			ownerPresent = ownerPresent || state.UserID == channel.OwnerID
+		}
+		if channel.OwnerID != "" && !ownerPresent {
+			slog.Info("Passing on temporary channel whose owner left while offline", "guild_id", guildID, "channel", channel.ID)
+			if err := d.ownerLeft(ctx, s, channel); err != nil {
+				slog.Warn("Unable to pass on temporary channel", "channel", channel.ID, "error", err)
+			}
+		}
+		return nil
+	}
+	if channelAge(channel.ID) < reconcileMinAge {
+		return nil
+	}
+	// Also restarts the timers of deletions scheduled before a restart.
+	if err := d.deleteWhenEmpty(ctx, s, channel); err != nil {
+		slog.Warn("Unable to delete empty temporary channel", "channel", channel.ID, "error", err)
+	}
+
+	return nil
+}
+
+// forgetCreatorChannel removes a creator channel from storage and cache and tells other instances.
+// It does not touch the Discord channel.
+func (d Discord) forgetCreatorChannel(ctx context.Context, guildID, channelID string) error {
+	d.cache.removeCreatorChannel(guildID, channelID)
+	if err := d.db.deleteCreatorChannel(ctx, channelID); err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to delete creator channel (id=%v) from database: %w", channelID, err)
+	}
+	d.publishChange(changeCreatorChannelDeleted, guildID, channelID)
+	return nil
+}
+
+// forgetTemporaryChannel removes a temporary channel from storage and cache and tells other instances.
+// It does not touch the Discord channel.
+func (d Discord) forgetTemporaryChannel(ctx context.Context, guildID, channelID string) error {
+	d.cache.removeTemporaryChannel(guildID, channelID)
+	d.joins.forget(channelID)
+	d.activities.forget(channelID)
+	d.recordChannelDeleted(channelID)
+	if err := d.db.deleteTemporaryChannel(ctx, channelID); err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to delete temporary channel (id=%v) from database: %w", channelID, err)
+	}
+	d.publishChange(changeTemporaryChannelDeleted, guildID, channelID)
+	return nil
+}
+
+func snapshotGuild(s *dgo.Session, guildID string) (guildSnapshot, error) {
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		return guildSnapshot{}, fmt.Errorf("unable to get guild from state cache: %w", err)
+	}
+
+	s.State.RLock()
+	defer s.State.RUnlock()
+
+	snapshot := guildSnapshot{
+		channels:    make(map[string]struct{}, len(guild.Channels)),
+		voiceStates: make(map[string][]*dgo.VoiceState),
+	}
+	for _, channel := range guild.Channels {
+		snapshot.channels[channel.ID] = struct{}{}
+	}
+	for _, state := range guild.VoiceStates {
+		copied := *state
+		snapshot.voiceStates[state.ChannelID] = append(snapshot.voiceStates[state.ChannelID], &copied)
+	}
+	return snapshot, nil
+}
+
+// channelAge derives the age of a channel from the timestamp in its snowflake ID.
+func channelAge(channelID string) time.Duration {
+	created, err := dgo.SnowflakeTimestamp(channelID)
+	if err != nil {
+		return 0
+	}
+	return time.Since(created)
+}
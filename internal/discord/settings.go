@@ -0,0 +1,311 @@
+package discord
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	dgo "github.com/bwmarrin/discordgo"
+)
+
+// Video quality modes of voice channels.
+const (
+	videoQualityAuto = 1
+	videoQualityFull = 2
+)
+
+var roleMentionPattern = regexp.MustCompile(`<@&(\d+)>|\b(\d{17,20})\b`)
+
+// voiceChannelCreateData extends dgo.GuildChannelCreateData by voice settings discordgo does not know.
+type voiceChannelCreateData struct {
+	dgo.GuildChannelCreateData
+	RTCRegion        string `json:"rtc_region,omitempty"`
+	VideoQualityMode int    `json:"video_quality_mode,omitempty"`
+}
+
+// temporaryChannelData returns how to create a temporary channel of creator owned by ownerID.
+// creatorChannel is the Discord channel of creator.
+func temporaryChannelData(s *dgo.Session, creator CreatorChannel, creatorChannel *dgo.Channel, name, ownerID string) voiceChannelCreateData {
+	data := voiceChannelCreateData{
+		GuildChannelCreateData: dgo.GuildChannelCreateData{
+			Name:      name,
+			Type:      dgo.ChannelTypeGuildVoice,
+			UserLimit: creatorChannel.UserLimit,
+			Bitrate:   creatorChannel.Bitrate,
+			Position:  creatorChannel.Position + 1,
+			ParentID:  creatorChannel.ParentID,
+			NSFW:      creator.NSFW,
+		},
+		RTCRegion:        creator.RTCRegion.String,
+		VideoQualityMode: int(creator.VideoQuality.Int64),
+	}
+	if creator.UserLimit.Valid {
+		data.UserLimit = int(creator.UserLimit.Int64)
+	}
+	if creator.Bitrate.Valid {
+		data.Bitrate = int(creator.Bitrate.Int64)
+	}
+	if creator.CategoryID.Valid && creator.CategoryID.String != creatorChannel.ParentID {
+		// The position is relative to the category, keep the channel where Discord puts it.
+		data.ParentID = creator.CategoryID.String
+		data.Position = 0
+	}
+
+	overwrites := creatorChannel.PermissionOverwrites
+	if creator.PermissionsChannelID.Valid {
+		channel, err := stateChannel(s, creator.PermissionsChannelID.String)
+		if err != nil {
+			slog.Warn("Unable to get permissions channel, using permissions of creator channel", "creator", creator.ID, "channel", creator.PermissionsChannelID.String, "error", err)
+		} else {
+			overwrites = channel.PermissionOverwrites
+		}
+	}
+	data.PermissionOverwrites = temporaryChannelOverwrites(overwrites, creator, ownerID)
+
+	return data
+}
+
+// temporaryChannelOverwrites extends the copied overwrites by the role list of creator and the owner permissions.
+func temporaryChannelOverwrites(copied []*dgo.PermissionOverwrite, creator CreatorChannel, ownerID string) []*dgo.PermissionOverwrite {
+	var overwrites []*dgo.PermissionOverwrite
+	for _, overwrite := range copied {
+		copied := *overwrite
+		overwrites = append(overwrites, &copied)
+	}
+	if roleIDs := creator.roleIDs(); len(roleIDs) > 0 {
+		// The ID of @everyone is the guild ID.
+		changeOverwrite(&overwrites, creator.GuildID, dgo.PermissionOverwriteTypeRole, overwriteChange{deny: ownerPermissions})
+		for _, roleID := range roleIDs {
+			changeOverwrite(&overwrites, roleID, dgo.PermissionOverwriteTypeRole, overwriteChange{allow: ownerPermissions})
+		}
+	}
+	changeOverwrite(&overwrites, ownerID, dgo.PermissionOverwriteTypeMember, overwriteChange{allow: ownerPermissions})
+
+	return overwrites
+}
+
+// changeOverwrite applies change to the overwrite of a role or member in overwrites, adding it if necessary.
+func changeOverwrite(overwrites *[]*dgo.PermissionOverwrite, id string, targetType dgo.PermissionOverwriteType, change overwriteChange) {
+	for _, overwrite := range *overwrites {
+		if overwrite.ID == id {
+			overwrite.Allow, overwrite.Deny = change.apply(overwrite.Allow, overwrite.Deny)
+			return
+		}
+	}
+
+	allow, deny := change.apply(0, 0)
+	if allow == 0 && deny == 0 {
+		return
+	}
+	*overwrites = append(*overwrites, &dgo.PermissionOverwrite{ID: id, Type: targetType, Allow: allow, Deny: deny})
+}
+
+// createVoiceChannel creates a voice channel, like s.GuildChannelCreateComplex does for other channels.
+func createVoiceChannel(s *dgo.Session, guildID string, data voiceChannelCreateData) (*dgo.Channel, error) {
+	endpoint := dgo.EndpointGuildChannels(guildID)
+	body, err := s.RequestWithBucketID("POST", endpoint, data, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var channel dgo.Channel
+	if err := json.Unmarshal(body, &channel); err != nil {
+		return nil, fmt.Errorf("unable to decode channel: %w", err)
+	}
+	return &channel, nil
+}
+
+func (d Discord) handleTempVoiceCreatorSettings(c *interactionContext) error {
+	options := c.optionMap()
+	channelID := options["channel"].StringValue() // required
+
+	ctx := context.Background()
+	creator, err := d.guildCreatorChannel(ctx, c.i.GuildID, channelID)
+	if err != nil {
+		return err
+	}
+
+	// reset:false alone only shows the settings.
+	changed := slices.ContainsFunc(c.options, func(option *dgo.ApplicationCommandInteractionDataOption) bool {
+		return option.Name != "channel" && (option.Name != "reset" || option.BoolValue())
+	})
+	if option, ok := options["reset"]; ok && option.BoolValue() {
+		creator = CreatorChannel{
+			ID:           creator.ID,
+			GuildID:      creator.GuildID,
+			NameTemplate: creator.NameTemplate,
+			OwnerPolicy:  ownerPolicyLongest,
+			Disabled:     creator.Disabled,
+		}
+	}
+	if option, ok := options["unset"]; ok {
+		switch option.StringValue() {
+		case "user_limit":
+			creator.UserLimit = sql.NullInt64{}
+		case "bitrate":
+			creator.Bitrate = sql.NullInt64{}
+		case "category":
+			creator.CategoryID = sql.NullString{}
+		case "permissions_from":
+			creator.PermissionsChannelID = sql.NullString{}
+		}
+	}
+	if option, ok := options["user_limit"]; ok {
+		creator.UserLimit = sql.NullInt64{Int64: option.IntValue(), Valid: true}
+	}
+	if option, ok := options["bitrate"]; ok {
+		// Discord expects bits per second.
+		creator.Bitrate = sql.NullInt64{Int64: option.IntValue() * 1000, Valid: true}
+	}
+	if option, ok := options["video_quality"]; ok {
+		creator.VideoQuality = sql.NullInt64{Int64: option.IntValue(), Valid: true}
+	}
+	if option, ok := options["region"]; ok {
+		region := strings.TrimSpace(option.StringValue())
+		if region == "auto" {
+			creator.RTCRegion = sql.NullString{}
+		} else {
+			if err := validateRegion(c.s, region); err != nil {
+				return err
+			}
+			creator.RTCRegion = sql.NullString{String: region, Valid: true}
+		}
+	}
+	if option, ok := options["category"]; ok {
+		creator.CategoryID = sql.NullString{String: option.Value.(string), Valid: true}
+	}
+	if option, ok := options["nsfw"]; ok {
+		creator.NSFW = option.BoolValue()
+	}
+	if option, ok := options["permissions_from"]; ok {
+		creator.PermissionsChannelID = sql.NullString{String: option.Value.(string), Valid: true}
+	}
+	if option, ok := options["roles"]; ok {
+		creator.RoleIDs = strings.Join(parseRoleIDs(option.StringValue()), ",")
+	}
+	if option, ok := options["delete_delay"]; ok {
+		creator.DeleteDelay = int(option.IntValue())
+	}
+	if option, ok := options["owner_policy"]; ok {
+		creator.OwnerPolicy = option.StringValue()
+	}
+	if option, ok := options["activity_names"]; ok {
+		creator.ActivityNames = option.BoolValue()
+	}
+
+	message := "Settings"
+	if changed {
+		if creator, err = d.db.updateCreatorChannel(ctx, creator); err != nil {
+			return fmt.Errorf("unable to update creator channel: %w", err)
+		}
+		message = "Changed settings"
+	}
+
+	text := fmt.Sprintf("%v of <#%v>:\n%v", message, creator.ID, describeSettings(creator))
+	if creator.ActivityNames && !d.config.presences {
+		text += "Activity names have no effect until the presence intent is enabled for the bot.\n"
+	}
+	return c.text(text)
+}
+
+// describeSettings lists the settings of a creator channel, one per line.
+func describeSettings(creator CreatorChannel) string {
+	inherited := "same as creator channel"
+	setting := func(name string, valid bool, value any) string {
+		if !valid {
+			return fmt.Sprintf("%v: %v\n", name, inherited)
+		}
+		return fmt.Sprintf("%v: %v\n", name, value)
+	}
+
+	var b strings.Builder
+	b.WriteString(setting("User limit", creator.UserLimit.Valid, creator.UserLimit.Int64))
+	b.WriteString(setting("Bitrate", creator.Bitrate.Valid, fmt.Sprintf("%v kbps", creator.Bitrate.Int64/1000)))
+	switch creator.VideoQuality.Int64 {
+	case videoQualityFull:
+		b.WriteString("Video quality: 720p\n")
+	default:
+		b.WriteString("Video quality: auto\n")
+	}
+	b.WriteString(fmt.Sprintf("Region: %v\n", cmp.Or(creator.RTCRegion.String, "auto")))
+	b.WriteString(setting("Category", creator.CategoryID.Valid, fmt.Sprintf("<#%v>", creator.CategoryID.String)))
+	b.WriteString(fmt.Sprintf("NSFW: %v\n", creator.NSFW))
+	b.WriteString(setting("Permissions", creator.PermissionsChannelID.Valid, fmt.Sprintf("copied from <#%v>", creator.PermissionsChannelID.String)))
+	if roleIDs := creator.roleIDs(); len(roleIDs) > 0 {
+		mentions := make([]string, len(roleIDs))
+		for i, roleID := range roleIDs {
+			mentions[i] = fmt.Sprintf("<@&%v>", roleID)
+		}
+		b.WriteString(fmt.Sprintf("Restricted to: %v\n", strings.Join(mentions, " ")))
+	}
+	if creator.DeleteDelay > 0 {
+		b.WriteString(fmt.Sprintf("Delete when empty: after %v\n", time.Duration(creator.DeleteDelay)*time.Second))
+	} else {
+		b.WriteString("Delete when empty: immediately\n")
+	}
+	switch creator.OwnerPolicy {
+	case ownerPolicyRandom:
+		b.WriteString("When the owner leaves: random member takes over\n")
+	case ownerPolicyNone:
+		b.WriteString("When the owner leaves: nobody takes over until claimed\n")
+	default:
+		b.WriteString("When the owner leaves: member present the longest takes over\n")
+	}
+	if creator.ActivityNames {
+		b.WriteString("Activity names: renamed after the most common activity of the members\n")
+	} else {
+		b.WriteString("Activity names: off\n")
+	}
+	return b.String()
+}
+
+func validateRegion(s *dgo.Session, region string) error {
+	regions, err := s.VoiceRegions()
+	if err != nil {
+		return newCommandError("Unable to get voice regions").WithErr(err)
+	}
+
+	ids := make([]string, len(regions))
+	for i, r := range regions {
+		ids[i] = r.ID
+	}
+	if !slices.Contains(ids, region) {
+		return newCommandError(fmt.Sprintf("Unknown region, use auto or one of %v.", strings.Join(ids, ", ")))
+	}
+	return nil
+}
+
+// parseRoleIDs extracts the role IDs from role mentions or plain IDs.
+func parseRoleIDs(text string) []string {
+	var roleIDs []string
+	for _, match := range roleMentionPattern.FindAllStringSubmatch(text, -1) {
+		roleID := cmp.Or(match[1], match[2])
+		if !slices.Contains(roleIDs, roleID) {
+			roleIDs = append(roleIDs, roleID)
+		}
+	}
+	return roleIDs
+}
+
+func (c CreatorChannel) roleIDs() []string {
+	return splitIDs(c.RoleIDs)
+}
+
+// stateChannel returns a channel from the state cache, or from Discord if it is not cached.
+func stateChannel(s *dgo.Session, channelID string) (*dgo.Channel, error) {
+	if channel, err := s.State.Channel(channelID); err == nil {
+		return channel, nil
+	}
+	channel, err := s.Channel(channelID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get channel: %w", err)
+	}
+	return channel, nil
+}
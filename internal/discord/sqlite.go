@@ -0,0 +1,485 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tombuente/omni/internal/database"
+)
+
+// SQLiteDatabase is the SQLite backed Storage, for small installs that do not want to run Postgres.
+type SQLiteDatabase struct {
+	db *sql.DB
+
+	// q is the database, or the transaction if the SQLiteDatabase was obtained through withTx.
+	q database.SQLQuerier
+}
+
+func MakeSQLiteDatabase(db *sql.DB) SQLiteDatabase {
+	return SQLiteDatabase{
+		db: db,
+		q:  db,
+	}
+}
+
+// withTx runs fn with a SQLiteDatabase whose queries all run in one transaction.
+// Calling withTx on a transactional SQLiteDatabase creates a savepoint.
+func (db SQLiteDatabase) withTx(ctx context.Context, fn func(tx Storage) error) error {
+	wrap := func(tx *sql.Tx) error {
+		return fn(SQLiteDatabase{db: db.db, q: tx})
+	}
+
+	if tx, ok := db.q.(*sql.Tx); ok {
+		return database.WithSQLSavepoint(ctx, tx, wrap)
+	}
+	return database.WithSQLTx(ctx, db.db, wrap)
+}
+
+func (db SQLiteDatabase) ensureGuild(ctx context.Context, id string) error {
+	const sql = `
+	INSERT INTO
+		guilds (id)
+	VALUES
+		(?1)
+	ON CONFLICT DO NOTHING
+	`
+	_, err := database.ExecSQL(ctx, db.q, sql, id)
+	return err
+}
+
+func (db SQLiteDatabase) deleteGuild(ctx context.Context, id string) error {
+	// SQLite does not support data modifying statements in WITH clauses.
+	statements := []string{
+		"DELETE FROM creator_channels WHERE guild_id = ?1",
+		"DELETE FROM temporary_channels WHERE guild_id = ?1",
+		"DELETE FROM groups WHERE guild_id = ?1",
+		"DELETE FROM user_preferences WHERE guild_id = ?1",
+		"DELETE FROM channel_sessions WHERE guild_id = ?1",
+		"DELETE FROM member_sessions WHERE guild_id = ?1",
+		"DELETE FROM guilds WHERE id = ?1",
+	}
+	return db.withTx(ctx, func(tx Storage) error {
+		q := tx.(SQLiteDatabase).q
+		for _, statement := range statements {
+			if _, err := database.ExecSQL(ctx, q, statement, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db SQLiteDatabase) guildSettings(ctx context.Context, id string) (GuildSettings, error) {
+	const sql = `
+	SELECT
+		id, create_cooldown, max_owned_channels, max_channels, limit_action
+	FROM
+		guilds
+	WHERE
+		id = ?1
+	`
+	return database.OneSQL[GuildSettings](ctx, db.q, sql, id)
+}
+
+func (db SQLiteDatabase) updateGuildSettings(ctx context.Context, params GuildSettings) (GuildSettings, error) {
+	const sql = `
+	UPDATE
+		guilds
+	SET
+		create_cooldown = ?2,
+		max_owned_channels = ?3,
+		max_channels = ?4,
+		limit_action = ?5
+	WHERE
+		id = ?1
+	RETURNING
+		id, create_cooldown, max_owned_channels, max_channels, limit_action
+	`
+	return database.OneSQL[GuildSettings](ctx, db.q, sql, params.GuildID, params.CreateCooldown, params.MaxOwnedChannels, params.MaxChannels, params.LimitAction)
+}
+
+func (db SQLiteDatabase) creatorChannel(ctx context.Context, id string) (CreatorChannel, error) {
+	const sql = `
+	SELECT
+		id, guild_id, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id, nsfw, permissions_channel_id, role_ids, delete_delay, owner_policy, disabled, activity_names
+	FROM
+		creator_channels
+	WHERE
+		id = ?1
+	`
+	return database.OneSQL[CreatorChannel](ctx, db.q, sql, id)
+}
+
+func (db SQLiteDatabase) creatorChannels(ctx context.Context, filter creatorChannelFilter) ([]CreatorChannel, error) {
+	const sql = `
+	SELECT
+		id, guild_id, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id, nsfw, permissions_channel_id, role_ids, delete_delay, owner_policy, disabled, activity_names
+	FROM
+		creator_channels
+	WHERE
+		(guild_id = ?1 OR ?1 IS NULL)
+	ORDER BY
+		id
+	`
+	return database.ManySQL[CreatorChannel](ctx, db.q, sql, filter.guildID)
+}
+
+func (db SQLiteDatabase) createCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error) {
+	const sql = `
+	INSERT INTO
+		creator_channels (id, guild_id, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id, nsfw, permissions_channel_id, role_ids, delete_delay, owner_policy, disabled, activity_names)
+	VALUES
+		(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15)
+	RETURNING
+		id, guild_id, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id, nsfw, permissions_channel_id, role_ids, delete_delay, owner_policy, disabled, activity_names
+	`
+	return database.OneSQL[CreatorChannel](ctx, db.q, sql, params.ID, params.GuildID, params.NameTemplate, params.UserLimit, params.Bitrate, params.VideoQuality, params.RTCRegion,
+		params.CategoryID, params.NSFW, params.PermissionsChannelID, params.RoleIDs, params.DeleteDelay, params.OwnerPolicy, params.Disabled, params.ActivityNames)
+}
+
+func (db SQLiteDatabase) updateCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error) {
+	const sql = `
+	UPDATE
+		creator_channels
+	SET
+		name_template = ?3,
+		user_limit = ?4,
+		bitrate = ?5,
+		video_quality = ?6,
+		rtc_region = ?7,
+		category_id = ?8,
+		nsfw = ?9,
+		permissions_channel_id = ?10,
+		role_ids = ?11,
+		delete_delay = ?12,
+		owner_policy = ?13,
+		disabled = ?14,
+		activity_names = ?15
+	WHERE
+		id = ?1 AND guild_id = ?2
+	RETURNING
+		id, guild_id, name_template, user_limit, bitrate, video_quality, rtc_region,
+		category_id, nsfw, permissions_channel_id, role_ids, delete_delay, owner_policy, disabled, activity_names
+	`
+	return database.OneSQL[CreatorChannel](ctx, db.q, sql, params.ID, params.GuildID, params.NameTemplate, params.UserLimit, params.Bitrate, params.VideoQuality, params.RTCRegion,
+		params.CategoryID, params.NSFW, params.PermissionsChannelID, params.RoleIDs, params.DeleteDelay, params.OwnerPolicy, params.Disabled, params.ActivityNames)
+}
+
+func (db SQLiteDatabase) deleteCreatorChannel(ctx context.Context, id string) error {
+	const sql = `
+	DELETE FROM
+		creator_channels
+	WHERE
+		id = ?1
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, id))
+}
+
+func (db SQLiteDatabase) temporaryChannel(ctx context.Context, id string) (TemporaryChannel, error) {
+	const sql = `
+	SELECT
+		id, guild_id, COALESCE(owner_id, '') AS owner_id, COALESCE(creator_id, '') AS creator_id, number, delete_at,
+		COALESCE(waiting_room_id, '') AS waiting_room_id, COALESCE(base_name, '') AS base_name
+	FROM
+		temporary_channels
+	WHERE
+		id = ?1
+	`
+	return database.OneSQL[TemporaryChannel](ctx, db.q, sql, id)
+}
+
+func (db SQLiteDatabase) temporaryChannels(ctx context.Context, filter temporaryChannelFilter) ([]TemporaryChannel, error) {
+	const sql = `
+	SELECT
+		id, guild_id, COALESCE(owner_id, '') AS owner_id, COALESCE(creator_id, '') AS creator_id, number, delete_at,
+		COALESCE(waiting_room_id, '') AS waiting_room_id, COALESCE(base_name, '') AS base_name
+	FROM
+		temporary_channels
+	WHERE
+		(guild_id = ?1 OR ?1 IS NULL)
+		AND (creator_id = ?2 OR ?2 IS NULL)
+	ORDER BY
+		id
+	`
+	return database.ManySQL[TemporaryChannel](ctx, db.q, sql, filter.guildID, filter.creatorID)
+}
+
+func (db SQLiteDatabase) createTemporaryChannel(ctx context.Context, params TemporaryChannel) (TemporaryChannel, error) {
+	const sql = `
+	INSERT INTO
+		temporary_channels (id, guild_id, owner_id, creator_id, number)
+	VALUES
+		(?1, ?2, NULLIF(?3, ''), NULLIF(?4, ''), ?5)
+	RETURNING id, guild_id, COALESCE(owner_id, '') AS owner_id, COALESCE(creator_id, '') AS creator_id, number, delete_at,
+		COALESCE(waiting_room_id, '') AS waiting_room_id, COALESCE(base_name, '') AS base_name
+	`
+	return database.OneSQL[TemporaryChannel](ctx, db.q, sql, params.ID, params.GuildID, params.OwnerID, params.CreatorID, params.Number)
+}
+
+func (db SQLiteDatabase) deleteTemporaryChannel(ctx context.Context, id string) error {
+	const sql = `
+	DELETE FROM
+		temporary_channels
+	WHERE
+		id = ?1
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, id))
+}
+
+func (db SQLiteDatabase) setTemporaryChannelDeleteAt(ctx context.Context, id string, deleteAt sql.NullTime) error {
+	const sql = `
+	UPDATE
+		temporary_channels
+	SET
+		delete_at = ?2
+	WHERE
+		id = ?1
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, id, deleteAt))
+}
+
+func (db SQLiteDatabase) setTemporaryChannelWaitingRoom(ctx context.Context, id, waitingRoomID string) error {
+	const sql = `
+	UPDATE
+		temporary_channels
+	SET
+		waiting_room_id = NULLIF(?2, '')
+	WHERE
+		id = ?1
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, id, waitingRoomID))
+}
+
+func (db SQLiteDatabase) setTemporaryChannelBaseName(ctx context.Context, id, baseName string) error {
+	const sql = `
+	UPDATE
+		temporary_channels
+	SET
+		base_name = NULLIF(?2, '')
+	WHERE
+		id = ?1
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, id, baseName))
+}
+
+func (db SQLiteDatabase) transferTemporaryChannel(ctx context.Context, id, fromOwnerID, toOwnerID string) error {
+	const sql = `
+	UPDATE
+		temporary_channels
+	SET
+		owner_id = NULLIF(?3, '')
+	WHERE
+		id = ?1 AND owner_id IS NULLIF(?2, '')
+	`
+	return expectUpdated(database.ExecSQL(ctx, db.q, sql, id, fromOwnerID, toOwnerID))
+}
+
+func (db SQLiteDatabase) userPreferences(ctx context.Context, guildID, userID string) (UserPreferences, error) {
+	const sql = `
+	SELECT
+		guild_id, user_id, name, user_limit, locked, hidden,
+		permitted_user_ids, permitted_role_ids, rejected_user_ids, opted_out
+	FROM
+		user_preferences
+	WHERE
+		guild_id = ?1 AND user_id = ?2
+	`
+	return database.OneSQL[UserPreferences](ctx, db.q, sql, guildID, userID)
+}
+
+func (db SQLiteDatabase) saveUserPreferences(ctx context.Context, params UserPreferences) (UserPreferences, error) {
+	const sql = `
+	INSERT INTO
+		user_preferences (guild_id, user_id, name, user_limit, locked, hidden,
+		permitted_user_ids, permitted_role_ids, rejected_user_ids, opted_out)
+	VALUES
+		(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10)
+	ON CONFLICT (guild_id, user_id) DO UPDATE SET
+		name = excluded.name,
+		user_limit = excluded.user_limit,
+		locked = excluded.locked,
+		hidden = excluded.hidden,
+		permitted_user_ids = excluded.permitted_user_ids,
+		permitted_role_ids = excluded.permitted_role_ids,
+		rejected_user_ids = excluded.rejected_user_ids,
+		opted_out = excluded.opted_out
+	RETURNING
+		guild_id, user_id, name, user_limit, locked, hidden,
+		permitted_user_ids, permitted_role_ids, rejected_user_ids, opted_out
+	`
+	return database.OneSQL[UserPreferences](ctx, db.q, sql, params.GuildID, params.UserID, params.Name, params.UserLimit, params.Locked, params.Hidden,
+		params.PermittedUserIDs, params.PermittedRoleIDs, params.RejectedUserIDs, params.OptedOut)
+}
+
+func (db SQLiteDatabase) createChannelSession(ctx context.Context, params ChannelSession) error {
+	const sql = `
+	INSERT INTO
+		channel_sessions (channel_id, guild_id, creator_id, owner_id, created_at)
+	VALUES
+		(?1, ?2, NULLIF(?3, ''), NULLIF(?4, ''), ?5)
+	`
+	_, err := database.ExecSQL(ctx, db.q, sql, params.ChannelID, params.GuildID, params.CreatorID, params.OwnerID, params.CreatedAt.UTC())
+	return err
+}
+
+func (db SQLiteDatabase) raiseChannelSessionPeak(ctx context.Context, channelID string, members int) error {
+	const sql = `
+	UPDATE
+		channel_sessions
+	SET
+		peak_members = MAX(peak_members, ?2)
+	WHERE
+		channel_id = ?1
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, channelID, members))
+}
+
+func (db SQLiteDatabase) endChannelSession(ctx context.Context, channelID string, deletedAt time.Time, memberSeconds int64) error {
+	const sql = `
+	UPDATE
+		channel_sessions
+	SET
+		deleted_at = ?2,
+		member_seconds = ?3
+	WHERE
+		channel_id = ?1 AND deleted_at IS NULL
+	`
+	return expectAffected(database.ExecSQL(ctx, db.q, sql, channelID, deletedAt.UTC(), memberSeconds))
+}
+
+// channelSessions compares timestamps as text, which works because all of them are stored in UTC.
+func (db SQLiteDatabase) channelSessions(ctx context.Context, filter historyFilter) ([]ChannelSession, error) {
+	const sql = `
+	SELECT
+		channel_id, guild_id, COALESCE(creator_id, '') AS creator_id, COALESCE(owner_id, '') AS owner_id,
+		created_at, deleted_at, peak_members, member_seconds
+	FROM
+		channel_sessions
+	WHERE
+		(guild_id = ?1 OR ?1 IS NULL)
+		AND (channel_id = ?2 OR ?2 IS NULL)
+		AND (deleted_at IS NULL OR deleted_at >= ?3 OR ?3 IS NULL)
+	`
+	return database.ManySQL[ChannelSession](ctx, db.q, sql, filter.guildID, filter.channelID, utcNullTime(filter.since))
+}
+
+func (db SQLiteDatabase) startMemberSession(ctx context.Context, params MemberSession) error {
+	const sql = `
+	INSERT INTO
+		member_sessions (guild_id, channel_id, user_id, joined_at)
+	SELECT
+		?1, ?2, ?3, ?4
+	WHERE NOT EXISTS (
+		SELECT 1 FROM member_sessions WHERE channel_id = ?2 AND user_id = ?3 AND left_at IS NULL
+	)
+	`
+	_, err := database.ExecSQL(ctx, db.q, sql, params.GuildID, params.ChannelID, params.UserID, params.JoinedAt.UTC())
+	return err
+}
+
+func (db SQLiteDatabase) endMemberSessions(ctx context.Context, channelID, userID string, leftAt time.Time) error {
+	const sql = `
+	UPDATE
+		member_sessions
+	SET
+		left_at = ?3
+	WHERE
+		channel_id = ?1 AND (user_id = ?2 OR ?2 = '') AND left_at IS NULL
+	`
+	_, err := database.ExecSQL(ctx, db.q, sql, channelID, userID, leftAt.UTC())
+	return err
+}
+
+func (db SQLiteDatabase) memberSessions(ctx context.Context, filter historyFilter) ([]MemberSession, error) {
+	const sql = `
+	SELECT
+		guild_id, channel_id, user_id, joined_at, left_at
+	FROM
+		member_sessions
+	WHERE
+		(guild_id = ?1 OR ?1 IS NULL)
+		AND (channel_id = ?2 OR ?2 IS NULL)
+		AND (left_at IS NULL OR left_at >= ?3 OR ?3 IS NULL)
+	`
+	return database.ManySQL[MemberSession](ctx, db.q, sql, filter.guildID, filter.channelID, utcNullTime(filter.since))
+}
+
+func (db SQLiteDatabase) pruneHistory(ctx context.Context, before time.Time) error {
+	statements := []string{
+		"DELETE FROM channel_sessions WHERE deleted_at < ?1",
+		"DELETE FROM member_sessions WHERE left_at < ?1",
+	}
+	return db.withTx(ctx, func(tx Storage) error {
+		q := tx.(SQLiteDatabase).q
+		for _, statement := range statements {
+			if _, err := database.ExecSQL(ctx, q, statement, before.UTC()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func utcNullTime(t sql.NullTime) sql.NullTime {
+	return sql.NullTime{Time: t.Time.UTC(), Valid: t.Valid}
+}
+
+func (db SQLiteDatabase) group(ctx context.Context, id int64) (Group, error) {
+	const sql = `
+	SELECT
+		id, name, guild_id
+	FROM
+		groups
+	WHERE
+		id = ?1
+	`
+	return database.OneSQL[Group](ctx, db.q, sql, id)
+}
+
+func (db SQLiteDatabase) groups(ctx context.Context, filter GroupFilter) ([]Group, error) {
+	const sql = `
+	SELECT
+		id, name, guild_id
+	FROM
+		groups
+	WHERE
+		(guild_id = ?1 OR ?1 IS NULL)
+		AND (name = ?2 OR ?2 IS NULL)
+	ORDER BY
+		id
+	`
+	return database.ManySQL[Group](ctx, db.q, sql, filter.guildID, filter.name)
+}
+
+func (db SQLiteDatabase) groupsPage(ctx context.Context, filter GroupFilter, cursor database.Cursor, limit int) (database.Page[Group], error) {
+	const sql = `
+	SELECT
+		id, name, guild_id
+	FROM
+		groups
+	WHERE
+		(guild_id = ?1 OR ?1 IS NULL)
+		AND (name = ?2 OR ?2 IS NULL)
+		AND (id > CAST(?3 AS INTEGER) OR ?3 IS NULL)
+	ORDER BY
+		id
+	LIMIT ?4
+	`
+	return database.PaginateSQL(ctx, db.q, sql, cursor, limit, groupKey, filter.guildID, filter.name)
+}
+
+func (db SQLiteDatabase) createGroup(ctx context.Context, params GroupParams) (Group, error) {
+	const sql = `
+	INSERT INTO
+		groups (name, guild_id)
+	VALUES
+		(?1, ?2)
+	RETURNING id, name, guild_id
+	`
+	return database.OneSQL[Group](ctx, db.q, sql, params.name, params.guildID)
+}
@@ -0,0 +1,106 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/tombuente/omni/internal/apperrors"
+	"github.com/tombuente/omni/internal/database"
+)
+
+// Storage persists guilds, creator channels, temporary channels, user preferences, history and groups.
+// Lookups of a single record, listings without results and deletions of records that
+// do not exist return apperrors.ErrNotFound. Pages may be empty.
+type Storage interface {
+	// ensureGuild creates the guild with default settings unless it exists already.
+	ensureGuild(ctx context.Context, id string) error
+	// deleteGuild deletes the guild and all of its creator channels, temporary channels, groups, user preferences
+	// and history.
+	deleteGuild(ctx context.Context, id string) error
+	guildSettings(ctx context.Context, id string) (GuildSettings, error)
+	// updateGuildSettings changes the settings of the guild of params.
+	updateGuildSettings(ctx context.Context, params GuildSettings) (GuildSettings, error)
+
+	creatorChannel(ctx context.Context, id string) (CreatorChannel, error)
+	creatorChannels(ctx context.Context, filter creatorChannelFilter) ([]CreatorChannel, error)
+	createCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error)
+	// updateCreatorChannel changes the settings of a creator channel in the guild of params.
+	updateCreatorChannel(ctx context.Context, params CreatorChannel) (CreatorChannel, error)
+	deleteCreatorChannel(ctx context.Context, id string) error
+
+	temporaryChannel(ctx context.Context, id string) (TemporaryChannel, error)
+	temporaryChannels(ctx context.Context, filter temporaryChannelFilter) ([]TemporaryChannel, error)
+	createTemporaryChannel(ctx context.Context, params TemporaryChannel) (TemporaryChannel, error)
+	deleteTemporaryChannel(ctx context.Context, id string) error
+	// setTemporaryChannelDeleteAt schedules the deletion of an empty temporary channel, or cancels it if deleteAt is unset.
+	setTemporaryChannelDeleteAt(ctx context.Context, id string, deleteAt sql.NullTime) error
+	// setTemporaryChannelWaitingRoom changes the waiting room of a temporary channel, an empty waitingRoomID removes it.
+	setTemporaryChannelWaitingRoom(ctx context.Context, id, waitingRoomID string) error
+	// setTemporaryChannelBaseName changes the name restored after an activity, an empty baseName removes it.
+	setTemporaryChannelBaseName(ctx context.Context, id, baseName string) error
+	// transferTemporaryChannel changes the owner of a temporary channel from fromOwnerID to toOwnerID,
+	// either of which is empty for channels without owner. It returns apperrors.ErrConflict if the channel does not
+	// exist or is not owned by fromOwnerID anymore.
+	transferTemporaryChannel(ctx context.Context, id, fromOwnerID, toOwnerID string) error
+
+	userPreferences(ctx context.Context, guildID, userID string) (UserPreferences, error)
+	// saveUserPreferences creates or replaces the preferences of a user in a guild.
+	saveUserPreferences(ctx context.Context, params UserPreferences) (UserPreferences, error)
+
+	createChannelSession(ctx context.Context, params ChannelSession) error
+	// raiseChannelSessionPeak raises the peak number of members of a channel session to members if it is lower.
+	raiseChannelSessionPeak(ctx context.Context, channelID string, members int) error
+	// endChannelSession ends a channel session unless it ended already.
+	endChannelSession(ctx context.Context, channelID string, deletedAt time.Time, memberSeconds int64) error
+	channelSessions(ctx context.Context, filter historyFilter) ([]ChannelSession, error)
+	// startMemberSession starts a member session unless the member has one in the channel already.
+	startMemberSession(ctx context.Context, params MemberSession) error
+	// endMemberSessions ends the member sessions in a channel of userID, or of all members if it is empty.
+	endMemberSessions(ctx context.Context, channelID, userID string, leftAt time.Time) error
+	memberSessions(ctx context.Context, filter historyFilter) ([]MemberSession, error)
+	// pruneHistory deletes the channel and member sessions that ended before before.
+	pruneHistory(ctx context.Context, before time.Time) error
+
+	group(ctx context.Context, id int64) (Group, error)
+	groups(ctx context.Context, filter GroupFilter) ([]Group, error)
+	groupsPage(ctx context.Context, filter GroupFilter, cursor database.Cursor, limit int) (database.Page[Group], error)
+	createGroup(ctx context.Context, params GroupParams) (Group, error)
+
+	// withTx runs fn with a Storage whose operations are applied atomically,
+	// that is, all of them if fn returns nil and none of them otherwise.
+	withTx(ctx context.Context, fn func(tx Storage) error) error
+}
+
+var (
+	_ Storage = Database{}
+	_ Storage = SQLiteDatabase{}
+	_ Storage = MemoryDatabase{}
+)
+
+// expectAffected turns a deletion or update that affected no rows into apperrors.ErrNotFound.
+func expectAffected(n int64, err error) error {
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return apperrors.ErrNotFound
+	}
+	return nil
+}
+
+// expectUpdated turns a conditional update that affected no rows into apperrors.ErrConflict.
+func expectUpdated(n int64, err error) error {
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return apperrors.ErrConflict
+	}
+	return nil
+}
+
+func groupKey(group Group) string {
+	return strconv.FormatInt(group.ID, 10)
+}
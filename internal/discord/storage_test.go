@@ -0,0 +1,202 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tombuente/omni/internal/apperrors"
+	"github.com/tombuente/omni/internal/database"
+	"github.com/tombuente/omni/internal/migrate"
+)
+
+const testGuildID = "1"
+
+// storages returns every Storage implementation that runs without external services, each with a guild.
+func storages(t *testing.T) map[string]Storage {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := database.OpenSQLite(ctx, filepath.Join(t.TempDir(), "omni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.MakeSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	storages := map[string]Storage{
+		"memory": MakeMemoryDatabase(),
+		"sqlite": MakeSQLiteDatabase(db),
+	}
+	for name, s := range storages {
+		if err := s.ensureGuild(ctx, testGuildID); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+	}
+	return storages
+}
+
+// testCreatorChannel returns a creator channel with every setting changed from its default.
+func testCreatorChannel(id string) CreatorChannel {
+	return CreatorChannel{
+		ID:                   id,
+		GuildID:              testGuildID,
+		NameTemplate:         defaultNameTemplate,
+		UserLimit:            sql.NullInt64{Int64: 5, Valid: true},
+		Bitrate:              sql.NullInt64{Int64: 96000, Valid: true},
+		VideoQuality:         sql.NullInt64{Int64: videoQualityFull, Valid: true},
+		RTCRegion:            sql.NullString{String: "rotterdam", Valid: true},
+		CategoryID:           sql.NullString{String: "2", Valid: true},
+		NSFW:                 true,
+		PermissionsChannelID: sql.NullString{String: "3", Valid: true},
+		RoleIDs:              "4,5",
+		DeleteDelay:          60,
+		OwnerPolicy:          ownerPolicyRandom,
+		Disabled:             true,
+		ActivityNames:        true,
+	}
+}
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Storage)
+	}{
+		{
+			name: "create",
+			run: func(t *testing.T, s Storage) {
+				ctx := context.Background()
+				if _, err := s.createCreatorChannel(ctx, testCreatorChannel("10")); err != nil {
+					t.Fatal(err)
+				}
+				creator, err := s.creatorChannel(ctx, "10")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := testCreatorChannel("10"); creator != want {
+					t.Fatalf("got %+v, want %+v", creator, want)
+				}
+			},
+		},
+		{
+			name: "duplicate",
+			run: func(t *testing.T, s Storage) {
+				ctx := context.Background()
+				if _, err := s.createCreatorChannel(ctx, testCreatorChannel("10")); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.createCreatorChannel(ctx, testCreatorChannel("10")); !errors.Is(err, apperrors.ErrConflict) {
+					t.Fatalf("creator channel: got %v, want ErrConflict", err)
+				}
+
+				group := GroupParams{guildID: testGuildID, name: "group"}
+				if _, err := s.createGroup(ctx, group); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.createGroup(ctx, group); !errors.Is(err, apperrors.ErrConflict) {
+					t.Fatalf("group: got %v, want ErrConflict", err)
+				}
+			},
+		},
+		{
+			name: "not found",
+			run: func(t *testing.T, s Storage) {
+				ctx := context.Background()
+				if _, err := s.creatorChannel(ctx, "10"); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("creator channel: got %v, want ErrNotFound", err)
+				}
+				if _, err := s.temporaryChannel(ctx, "10"); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("temporary channel: got %v, want ErrNotFound", err)
+				}
+				filter := creatorChannelFilter{guildID: sql.NullString{String: testGuildID, Valid: true}}
+				if _, err := s.creatorChannels(ctx, filter); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("creator channels: got %v, want ErrNotFound", err)
+				}
+				if _, err := s.updateCreatorChannel(ctx, testCreatorChannel("10")); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("update: got %v, want ErrNotFound", err)
+				}
+			},
+		},
+		{
+			name: "delete",
+			run: func(t *testing.T, s Storage) {
+				ctx := context.Background()
+				if _, err := s.createTemporaryChannel(ctx, TemporaryChannel{ID: "20", GuildID: testGuildID, OwnerID: "30"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.deleteTemporaryChannel(ctx, "20"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.temporaryChannel(ctx, "20"); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("get deleted: got %v, want ErrNotFound", err)
+				}
+				if err := s.deleteTemporaryChannel(ctx, "20"); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("delete twice: got %v, want ErrNotFound", err)
+				}
+			},
+		},
+		{
+			name: "transfer conflict",
+			run: func(t *testing.T, s Storage) {
+				ctx := context.Background()
+				if _, err := s.createTemporaryChannel(ctx, TemporaryChannel{ID: "20", GuildID: testGuildID, OwnerID: "30"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.transferTemporaryChannel(ctx, "20", "31", "32"); !errors.Is(err, apperrors.ErrConflict) {
+					t.Fatalf("got %v, want ErrConflict", err)
+				}
+				if err := s.transferTemporaryChannel(ctx, "20", "30", "32"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "transaction rollback",
+			run: func(t *testing.T, s Storage) {
+				ctx := context.Background()
+				errRollback := errors.New("rollback")
+				err := s.withTx(ctx, func(tx Storage) error {
+					if _, err := tx.createCreatorChannel(ctx, testCreatorChannel("10")); err != nil {
+						return err
+					}
+					return errRollback
+				})
+				if !errors.Is(err, errRollback) {
+					t.Fatalf("got %v, want the error of fn", err)
+				}
+				if _, err := s.creatorChannel(ctx, "10"); !errors.Is(err, apperrors.ErrNotFound) {
+					t.Fatalf("got %v, want ErrNotFound after rollback", err)
+				}
+
+				err = s.withTx(ctx, func(tx Storage) error {
+					_, err := tx.createCreatorChannel(ctx, testCreatorChannel("10"))
+					return err
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.creatorChannel(ctx, "10"); err != nil {
+					t.Fatalf("got %v after commit", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, s := range storages(t) {
+				t.Run(name, func(t *testing.T) {
+					tt.run(t, s)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package discord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// maxUserLimit is the highest user limit Discord allows on voice channels.
+const maxUserLimit = 99
+
+// ownerPermissions are granted to the owner of a temporary channel and to permitted users and roles,
+// so that they can still see and join the channel when it is hidden or locked.
+const ownerPermissions = dgo.PermissionViewChannel | dgo.PermissionVoiceConnect
+
+// overwriteChange describes how the permission overwrite of a role or member changes.
+// Permissions in inherit are neither allowed nor denied afterwards, all others are kept.
+type overwriteChange struct {
+	allow   int64
+	deny    int64
+	inherit int64
+}
+
+// apply returns the allowed and denied permissions of an overwrite after the change.
+func (c overwriteChange) apply(allow, deny int64) (int64, int64) {
+	allow = allow&^(c.deny|c.inherit) | c.allow
+	deny = deny&^(c.allow|c.inherit) | c.deny
+	return allow, deny
+}
+
+func (d Discord) handleTempVoiceRename(c *interactionContext) error {
+	name := c.optionMap()["name"].StringValue() // required
+
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+	return d.renameTemporaryChannel(c, channel, name)
+}
+
+func (d Discord) handleTempVoiceLimit(c *interactionContext) error {
+	limit := int(c.optionMap()["limit"].IntValue()) // required
+
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+	return d.limitTemporaryChannel(c, channel, limit)
+}
+
+// handleTempVoiceOverwrite applies change to the overwrite of @everyone and remembers
+// the change in the preferences of the owner.
+func (d Discord) handleTempVoiceOverwrite(c *interactionContext, change overwriteChange, remember func(p *UserPreferences), message string) error {
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+	return d.changeEveryone(c, channel, change, remember, message)
+}
+
+func (d Discord) handleTempVoicePermit(c *interactionContext) error {
+	targetID := c.optionMap()["target"].Value.(string) // required
+
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+
+	targetType := dgo.PermissionOverwriteTypeMember
+	mention := fmt.Sprintf("<@%v>", targetID)
+	if resolved := c.i.ApplicationCommandData().Resolved; resolved != nil {
+		if _, ok := resolved.Roles[targetID]; ok {
+			targetType = dgo.PermissionOverwriteTypeRole
+			mention = fmt.Sprintf("<@&%v>", targetID)
+		}
+	}
+
+	if err := updateOverwrite(c.s, channel.ID, targetID, targetType, overwriteChange{allow: ownerPermissions}); err != nil {
+		return newCommandError("Unable to change channel permissions").WithErr(err)
+	}
+	d.rememberPreferences(channel.GuildID, channel.OwnerID, func(p *UserPreferences) {
+		if targetType == dgo.PermissionOverwriteTypeRole {
+			p.PermittedRoleIDs = addID(p.PermittedRoleIDs, targetID)
+			return
+		}
+		p.PermittedUserIDs = addID(p.PermittedUserIDs, targetID)
+		p.RejectedUserIDs = removeID(p.RejectedUserIDs, targetID)
+	})
+
+	return c.text(fmt.Sprintf("Permitted %v to join the channel.", mention))
+}
+
+func (d Discord) handleTempVoiceReject(c *interactionContext) error {
+	userID := c.optionMap()["user"].Value.(string) // required
+
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+	return d.rejectUser(c, channel, userID)
+}
+
+func (d Discord) handleTempVoiceTransfer(c *interactionContext) error {
+	userID := c.optionMap()["user"].Value.(string) // required
+
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+	return d.transferTemporaryChannel(c, channel, userID)
+}
+
+func (d Discord) handleTempVoiceClaim(c *interactionContext) error {
+	channel, err := d.currentTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+	if channel.OwnerID == c.userID() {
+		return newCommandError("You already own this channel.")
+	}
+	if channel.OwnerID != "" {
+		if state, err := c.s.State.VoiceState(channel.GuildID, channel.OwnerID); err == nil && state.ChannelID == channel.ID {
+			return newCommandError("The owner is still in the channel.")
+		}
+	}
+
+	if err := d.transferOwnership(context.Background(), c.s, channel, c.userID()); err != nil {
+		return err
+	}
+
+	return c.text("You are the new owner of the channel.")
+}
+
+func (d Discord) renameTemporaryChannel(c *interactionContext, channel TemporaryChannel, name string) error {
+	// Channel renames are heavily rate limited, the request may be blocked for a while.
+	if err := c.deferCmd(); err != nil {
+		return err
+	}
+	if _, err := c.s.ChannelEdit(channel.ID, &dgo.ChannelEdit{Name: name}); err != nil {
+		return newCommandError("Unable to rename channel").WithErr(err)
+	}
+	// The chosen name wins over activity names.
+	d.activities.pause(channel.ID)
+	if channel.BaseName != "" {
+		if err := d.db.setTemporaryChannelBaseName(context.Background(), channel.ID, ""); err != nil {
+			slog.Warn("Unable to remove name of temporary channel", "channel", channel.ID, "error", err)
+		}
+	}
+	d.rememberPreferences(channel.GuildID, channel.OwnerID, func(p *UserPreferences) {
+		p.Name = sql.NullString{String: name, Valid: true}
+	})
+
+	return c.text(fmt.Sprintf("Renamed the channel to `%v`.", name))
+}
+
+func (d Discord) limitTemporaryChannel(c *interactionContext, channel TemporaryChannel, limit int) error {
+	if err := setUserLimit(c.s, channel.ID, limit); err != nil {
+		return newCommandError("Unable to change the user limit").WithErr(err)
+	}
+	d.rememberPreferences(channel.GuildID, channel.OwnerID, func(p *UserPreferences) {
+		p.UserLimit = sql.NullInt64{Int64: int64(limit), Valid: true}
+	})
+
+	if limit == 0 {
+		return c.text("Removed the user limit.")
+	}
+	return c.text(fmt.Sprintf("Limited the channel to %v users.", limit))
+}
+
+// changeEveryone applies change to the overwrite of @everyone, whose role ID is the guild ID.
+func (d Discord) changeEveryone(c *interactionContext, channel TemporaryChannel, change overwriteChange, remember func(p *UserPreferences), message string) error {
+	if err := updateOverwrite(c.s, channel.ID, channel.GuildID, dgo.PermissionOverwriteTypeRole, change); err != nil {
+		return newCommandError("Unable to change channel permissions").WithErr(err)
+	}
+	d.rememberPreferences(channel.GuildID, channel.OwnerID, remember)
+
+	return c.text(message)
+}
+
+// rejectUser forbids a user to see and join a temporary channel and disconnects them if they are in it.
+func (d Discord) rejectUser(c *interactionContext, channel TemporaryChannel, userID string) error {
+	if userID == channel.OwnerID {
+		return newCommandError("You cannot reject yourself.")
+	}
+
+	if err := updateOverwrite(c.s, channel.ID, userID, dgo.PermissionOverwriteTypeMember, overwriteChange{deny: ownerPermissions}); err != nil {
+		return newCommandError("Unable to change channel permissions").WithErr(err)
+	}
+	d.rememberPreferences(channel.GuildID, channel.OwnerID, func(p *UserPreferences) {
+		p.RejectedUserIDs = addID(p.RejectedUserIDs, userID)
+		p.PermittedUserIDs = removeID(p.PermittedUserIDs, userID)
+	})
+
+	if state, err := c.s.State.VoiceState(channel.GuildID, userID); err == nil && state.ChannelID == channel.ID {
+		if err := c.s.GuildMemberMove(channel.GuildID, userID, nil); err != nil {
+			return newCommandError("Rejected the user but was unable to disconnect them").WithErr(err)
+		}
+	}
+
+	return c.text(fmt.Sprintf("Rejected <@%v>.", userID))
+}
+
+func (d Discord) transferTemporaryChannel(c *interactionContext, channel TemporaryChannel, userID string) error {
+	if userID == channel.OwnerID {
+		return newCommandError("You already own this channel.")
+	}
+	if state, err := c.s.State.VoiceState(channel.GuildID, userID); err != nil || state.ChannelID != channel.ID {
+		return newCommandError("The new owner must be in the channel.")
+	}
+
+	if err := d.transferOwnership(context.Background(), c.s, channel, userID); err != nil {
+		return err
+	}
+
+	return c.text(fmt.Sprintf("<@%v> is the new owner of the channel.", userID))
+}
+
+// currentTemporaryChannel returns the temporary channel the user of an interaction is connected to.
+func (d Discord) currentTemporaryChannel(c *interactionContext) (TemporaryChannel, error) {
+	state, err := c.s.State.VoiceState(c.i.GuildID, c.userID())
+	if err != nil || state.ChannelID == "" {
+		return TemporaryChannel{}, newCommandError("Join a temporary channel first.")
+	}
+
+	channel, err := d.db.temporaryChannel(context.Background(), state.ChannelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return TemporaryChannel{}, newCommandError("You are not in a temporary channel.").WithErr(err)
+	}
+	if err != nil {
+		return TemporaryChannel{}, fmt.Errorf("unable to get temporary channel: %w", err)
+	}
+	return channel, nil
+}
+
+// ownedTemporaryChannel returns the temporary channel the user of an interaction is connected to,
+// provided that they own it.
+func (d Discord) ownedTemporaryChannel(c *interactionContext) (TemporaryChannel, error) {
+	channel, err := d.currentTemporaryChannel(c)
+	if err != nil {
+		return TemporaryChannel{}, err
+	}
+	if err := requireOwner(c, channel); err != nil {
+		return TemporaryChannel{}, err
+	}
+	return channel, nil
+}
+
+// requireOwner fails unless the user of an interaction owns channel.
+func requireOwner(c *interactionContext, channel TemporaryChannel) error {
+	if channel.OwnerID != c.userID() {
+		return newCommandError("Only the owner of the channel can do this.").WithErr(apperrors.ErrForbidden)
+	}
+	return nil
+}
+
+// transferOwnership makes userID, or nobody if it is empty, the owner of a temporary channel and moves
+// the owner permissions. It fails with apperrors.ErrConflict if the owner changed since channel was read.
+func (d Discord) transferOwnership(ctx context.Context, s *dgo.Session, channel TemporaryChannel, userID string) error {
+	if err := d.db.transferTemporaryChannel(ctx, channel.ID, channel.OwnerID, userID); err != nil {
+		return fmt.Errorf("unable to transfer temporary channel (id=%v): %w", channel.ID, err)
+	}
+
+	if userID != "" {
+		if err := updateOverwrite(s, channel.ID, userID, dgo.PermissionOverwriteTypeMember, overwriteChange{allow: ownerPermissions}); err != nil {
+			return newCommandError("Transferred the channel but was unable to change its permissions").WithErr(err)
+		}
+	}
+	if channel.OwnerID != "" {
+		if err := updateOverwrite(s, channel.ID, channel.OwnerID, dgo.PermissionOverwriteTypeMember, overwriteChange{inherit: ownerPermissions}); err != nil {
+			slog.Warn("Unable to revoke permissions of previous owner", "channel", channel.ID, "user", channel.OwnerID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// updateOverwrite applies change to the permission overwrite of a role or member in a channel.
+// The overwrite is removed if it neither allows nor denies anything afterwards.
+func updateOverwrite(s *dgo.Session, channelID, targetID string, targetType dgo.PermissionOverwriteType, change overwriteChange) error {
+	channel, err := stateChannel(s, channelID)
+	if err != nil {
+		return err
+	}
+
+	var current *dgo.PermissionOverwrite
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.ID == targetID {
+			current = overwrite
+			break
+		}
+	}
+
+	var allow, deny int64
+	if current != nil {
+		allow, deny = current.Allow, current.Deny
+	}
+	allow, deny = change.apply(allow, deny)
+
+	if allow == 0 && deny == 0 {
+		if current == nil {
+			return nil
+		}
+		return s.ChannelPermissionDelete(channelID, targetID)
+	}
+	return s.ChannelPermissionSet(channelID, targetID, targetType, allow, deny)
+}
+
+// setUserLimit changes the user limit of a voice channel. dgo.ChannelEdit cannot express
+// removing the limit, as it omits a UserLimit of zero.
+func setUserLimit(s *dgo.Session, channelID string, limit int) error {
+	data := struct {
+		UserLimit int `json:"user_limit"`
+	}{limit}
+	_, err := s.RequestWithBucketID("PATCH", dgo.EndpointChannel(channelID), data, dgo.EndpointChannel(channelID))
+	return err
+}
@@ -2,17 +2,24 @@ package discord
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	dgo "github.com/bwmarrin/discordgo"
 	"github.com/tombuente/omni/internal/apperrors"
 )
 
-// voiceStates adds VoiceStateUpdate event handlers to the session.
+// voiceStates adds VoiceStateUpdate event handlers to the session. Updates of a guild are handled one after
+// another in the order they were received, so that for example two members joining a creator channel at once
+// do not race for the same channel number.
 func (d Discord) voiceStates() {
-	d.session.AddHandler(wrapVoiceStateUpdate(d.voiceStateUpdate))
+	handle := wrapVoiceStateUpdate(d.voiceStateUpdate)
+	d.session.AddHandler(func(s *dgo.Session, e *dgo.VoiceStateUpdate) {
+		d.events.push(e.GuildID, func() { handle(s, e) })
+	})
 }
 
 func wrapVoiceStateUpdate(handleFunc func(s *dgo.Session, e *dgo.VoiceStateUpdate) error) func(s *dgo.Session, e *dgo.VoiceStateUpdate) {
@@ -24,13 +31,22 @@ func wrapVoiceStateUpdate(handleFunc func(s *dgo.Session, e *dgo.VoiceStateUpdat
 }
 
 func (d Discord) voiceStateUpdate(s *dgo.Session, e *dgo.VoiceStateUpdate) error {
+	var beforeChannelID string
+	if e.BeforeUpdate != nil {
+		beforeChannelID = e.BeforeUpdate.ChannelID
+	}
+	if e.ChannelID == beforeChannelID {
+		// Mute, deafen, stream etc. in the same channel.
+		return nil
+	}
+
 	if e.ChannelID != "" {
 		if err := d.joinedChannel(s, e); err != nil {
 			return err
 		}
 	}
 
-	if e.BeforeUpdate != nil {
+	if beforeChannelID != "" {
 		return d.leftChannel(s, e.BeforeUpdate)
 	}
 
@@ -38,63 +54,135 @@ func (d Discord) voiceStateUpdate(s *dgo.Session, e *dgo.VoiceStateUpdate) error
 }
 
 func (d Discord) joinedChannel(s *dgo.Session, e *dgo.VoiceStateUpdate) error {
-	ok, err := d.isCreatorChannel(e.ChannelID)
+	ok, err := d.cache.isCreatorChannel(context.Background(), e.GuildID, e.ChannelID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return d.joinedCreatorChannel(s, e.VoiceState)
+	}
+
+	ok, err = d.cache.isTemporaryChannel(context.Background(), e.GuildID, e.ChannelID)
 	if err != nil {
 		return err
 	}
 	if ok {
-		d.joinedCreatorChannel(s, e)
+		unlock := d.locks.lock(e.ChannelID)
+		defer unlock()
+
+		d.joins.add(e.ChannelID, e.UserID, time.Now())
+		d.recordJoin(s, e.VoiceState)
+		d.scheduleActivityRename(s, e.GuildID, e.ChannelID)
+		return d.cancelDeletion(context.Background(), e.ChannelID)
+	}
+
+	temporaryChannelID, err := d.cache.waitingRoom(context.Background(), e.GuildID, e.ChannelID)
+	if err != nil {
+		return err
+	}
+	if temporaryChannelID != "" {
+		return d.knock(s, e.VoiceState, temporaryChannelID)
 	}
 
 	return nil
 }
 
 func (d Discord) leftChannel(s *dgo.Session, state *dgo.VoiceState) error {
-	ok, err := d.isTemporaryChannel(state.ChannelID)
+	ok, err := d.cache.isTemporaryChannel(context.Background(), state.GuildID, state.ChannelID)
 	if err != nil {
 		return err
 	}
 	if ok {
-		d.leftTemporaryChannel(s, state)
+		return d.leftTemporaryChannel(s, state)
 	}
 
 	return nil
 }
 
-func (d Discord) joinedCreatorChannel(s *dgo.Session, e *dgo.VoiceStateUpdate) error {
+func (d Discord) joinedCreatorChannel(s *dgo.Session, e *dgo.VoiceState) error {
+	ctx := context.Background()
+
 	channel, err := s.Channel(e.ChannelID)
 	if err != nil {
 		return fmt.Errorf("unable to get channel: %w", err)
 	}
+	creator, err := d.db.creatorChannel(ctx, e.ChannelID)
+	if err != nil {
+		return fmt.Errorf("unable to get creator channel: %w", err)
+	}
+	if creator.Disabled {
+		return nil
+	}
+
+	settings, err := d.guildSettings(ctx, e.GuildID)
+	if err != nil {
+		return err
+	}
+	reason, ownedID, err := d.limitExceeded(ctx, settings, e.UserID)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return d.limitHit(s, e, settings, reason, ownedID)
+	}
+
+	member, err := voiceStateMember(s, e)
+	if err != nil {
+		return err
+	}
 
-	data := dgo.GuildChannelCreateData{
-		Name:      e.Member.User.Username,
-		Type:      dgo.ChannelTypeGuildVoice,
-		UserLimit: channel.UserLimit,
-		Position:  channel.Position + 1,
-		ParentID:  channel.ParentID,
+	number, err := d.nextNumber(ctx, creator.ID)
+	if err != nil {
+		return err
 	}
-	tempChannel, err := s.GuildChannelCreateComplex(e.GuildID, data)
+
+	preferences, err := d.preferences(ctx, e.GuildID, e.UserID)
 	if err != nil {
 		return err
 	}
 
-	if _, err := d.db.createTemporaryChannel(context.Background(), TemporaryChannel{ID: tempChannel.ID, GuildID: tempChannel.GuildID}); err != nil {
-		if _, err := s.ChannelDelete(channel.ID); err != nil {
-			slog.Warn("A temporary channel was created but is not tracked in the database")
+	name := renderName(creator.NameTemplate, newNameData(s, member, channel, number))
+	data := temporaryChannelData(s, creator, channel, name, e.UserID)
+	applyPreferences(&data, preferences)
+	tempChannel, err := createVoiceChannel(s, e.GuildID, data)
+	if err != nil {
+		return fmt.Errorf("unable to create temporary channel: %w", err)
+	}
+
+	params := TemporaryChannel{
+		ID:        tempChannel.ID,
+		GuildID:   tempChannel.GuildID,
+		OwnerID:   e.UserID,
+		CreatorID: creator.ID,
+		Number:    number,
+	}
+	if _, err := d.db.createTemporaryChannel(ctx, params); err != nil {
+		if _, err := s.ChannelDelete(tempChannel.ID); err != nil {
+			slog.Warn("A temporary channel was created but is not tracked in the database", "channel", tempChannel.ID, "error", err)
 		}
 
 		return err
 	}
+	d.cache.addTemporaryChannel(tempChannel.GuildID, tempChannel.ID)
+	d.publishChange(changeTemporaryChannelCreated, tempChannel.GuildID, tempChannel.ID)
 
 	// Try to move the user into the newly created temporary channel.
 	// If not possible, try deleting the now empty temporary channel.
 	if err := s.GuildMemberMove(e.GuildID, e.UserID, &tempChannel.ID); err != nil {
 		if _, err := s.ChannelDelete(tempChannel.ID); err != nil {
-			slog.Warn("Unable to delete orphaned temporary channel")
+			slog.Warn("Unable to delete orphaned temporary channel", "channel", tempChannel.ID, "error", err)
+		} else if err := d.forgetTemporaryChannel(ctx, tempChannel.GuildID, tempChannel.ID); err != nil {
+			slog.Warn("Unable to forget orphaned temporary channel", "channel", tempChannel.ID, "error", err)
 		}
 		return fmt.Errorf("unable to move user to temporary channel: %w", err)
 	}
+	// Only channels the member got count towards the cooldown and the history.
+	d.cooldowns.record(userKey{e.GuildID, e.UserID})
+	d.recordChannelCreated(params)
+
+	if err := postControlPanel(s, tempChannel.ID, e.UserID); err != nil {
+		slog.Warn("Unable to post control panel", "channel", tempChannel.ID, "error", err)
+	}
 
 	return nil
 }
@@ -105,45 +193,41 @@ func (d Discord) leftTemporaryChannel(s *dgo.Session, state *dgo.VoiceState) err
 		return fmt.Errorf("unable to get guild from state cache: %w", err)
 	}
 
-	channelID := state.ChannelID
-	if channelHasUsers(guild, channelID) {
-		// Must not delete a temporary channel if users are still in it.
+	unlock := d.locks.lock(state.ChannelID)
+	defer unlock()
+
+	d.joins.remove(state.ChannelID, state.UserID)
+	d.recordLeave(state.ChannelID, state.UserID)
+	d.scheduleActivityRename(s, state.GuildID, state.ChannelID)
+
+	ctx := context.Background()
+	channel, err := d.db.temporaryChannel(ctx, state.ChannelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// Deleted in the meantime, possibly by another instance.
 		return nil
 	}
-
-	_, err = d.db.temporaryChannel(context.Background(), channelID)
 	if err != nil {
-		if errors.Is(err, apperrors.ErrNotFound) {
-			return nil
-		}
-		return fmt.Errorf("unable to query temporary channel (id=%v) from database: %w", channelID, err)
+		return fmt.Errorf("unable to get temporary channel: %w", err)
 	}
 
-	if _, err := s.ChannelDelete(channelID); err != nil {
-		return fmt.Errorf("unable to delete channel: %w", err)
+	if channelHasUsers(guild, state.ChannelID) {
+		// Must not delete a temporary channel if users are still in it.
+		if state.UserID == channel.OwnerID {
+			return d.ownerLeft(ctx, s, channel)
+		}
+		return nil
 	}
 
-	return nil
-}
-
-func (d Discord) isCreatorChannel(id string) (bool, error) {
-	_, err := d.db.creatorChannel(context.Background(), id)
-	if err == nil {
-		return true, nil
-	} else if errors.Is(err, apperrors.ErrNotFound) {
-		return false, err
-	}
-	return false, nil
+	return d.deleteWhenEmpty(ctx, s, channel)
 }
 
-func (d Discord) isTemporaryChannel(id string) (bool, error) {
-	_, err := d.db.temporaryChannel(context.Background(), id)
-	if err == nil {
-		return true, nil
-	} else if errors.Is(err, apperrors.ErrNotFound) {
-		return false, err
+// nextNumber returns the number of the next temporary channel of a creator channel.
+func (d Discord) nextNumber(ctx context.Context, creatorID string) (int, error) {
+	channels, err := d.db.temporaryChannels(ctx, temporaryChannelFilter{creatorID: sql.NullString{String: creatorID, Valid: true}})
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return 0, fmt.Errorf("unable to query temporary channels: %w", err)
 	}
-	return false, nil
+	return freeNumber(channels), nil
 }
 
 func channelHasUsers(guild *dgo.Guild, channelID string) bool {
@@ -156,3 +240,20 @@ func channelHasUsers(guild *dgo.Guild, channelID string) bool {
 	}
 	return hasUsers
 }
+
+// voiceStateMember returns the member of a voice state. Voice states of the guild state cache
+// do not carry the member, it is looked up in the state cache or fetched in that case.
+func voiceStateMember(s *dgo.Session, state *dgo.VoiceState) (*dgo.Member, error) {
+	if state.Member != nil && state.Member.User != nil {
+		return state.Member, nil
+	}
+
+	if member, err := s.State.Member(state.GuildID, state.UserID); err == nil {
+		return member, nil
+	}
+	member, err := s.GuildMember(state.GuildID, state.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get member: %w", err)
+	}
+	return member, nil
+}
@@ -0,0 +1,197 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	dgo "github.com/bwmarrin/discordgo"
+	"github.com/tombuente/omni/internal/apperrors"
+)
+
+// knockCustomID is the handler name in the custom IDs of the buttons answering members in waiting rooms.
+const knockCustomID = "knock"
+
+// waitingRoomPrefix is put in front of the name of a temporary channel to name its waiting room.
+const waitingRoomPrefix = "⏳ "
+
+func (d Discord) handleTempVoiceWaitingRoom(c *interactionContext) error {
+	enabled := c.optionMap()["enabled"].BoolValue() // required
+
+	channel, err := d.ownedTemporaryChannel(c)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		if channel.WaitingRoomID == "" {
+			return newCommandError("The channel has no waiting room.")
+		}
+		if err := d.removeWaitingRoom(context.Background(), c.s, channel); err != nil {
+			return newCommandError("Unable to remove the waiting room").WithErr(err)
+		}
+		return c.text("Removed the waiting room.")
+	}
+
+	if channel.WaitingRoomID != "" {
+		return newCommandError(fmt.Sprintf("The channel already has a waiting room, <#%v>.", channel.WaitingRoomID))
+	}
+	room, err := d.createWaitingRoom(context.Background(), c.s, channel)
+	if err != nil {
+		return err
+	}
+
+	return c.text(fmt.Sprintf("Members can now wait in <#%v>, you will be asked whether to let them in.", room.ID))
+}
+
+// createWaitingRoom creates a voice channel next to a temporary channel in which members knock to be let in.
+func (d Discord) createWaitingRoom(ctx context.Context, s *dgo.Session, channel TemporaryChannel) (*dgo.Channel, error) {
+	discordChannel, err := stateChannel(s, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := waitingRoomPrefix + discordChannel.Name
+	if runes := []rune(name); len(runes) > maxChannelNameLength {
+		name = string(runes[:maxChannelNameLength])
+	}
+	room, err := s.GuildChannelCreateComplex(channel.GuildID, dgo.GuildChannelCreateData{
+		Name:     name,
+		Type:     dgo.ChannelTypeGuildVoice,
+		ParentID: discordChannel.ParentID,
+		Position: discordChannel.Position + 1,
+	})
+	if err != nil {
+		return nil, newCommandError("Unable to create the waiting room").WithErr(err)
+	}
+
+	if err := d.db.setTemporaryChannelWaitingRoom(ctx, channel.ID, room.ID); err != nil {
+		if _, err := s.ChannelDelete(room.ID); err != nil {
+			slog.Warn("A waiting room was created but is not tracked in the database", "channel", room.ID, "error", err)
+		}
+		return nil, fmt.Errorf("unable to save waiting room of temporary channel (id=%v): %w", channel.ID, err)
+	}
+	d.cache.addWaitingRoom(channel.GuildID, room.ID, channel.ID)
+	d.publishChange(changeWaitingRoomChanged, channel.GuildID, room.ID)
+
+	return room, nil
+}
+
+// removeWaitingRoom deletes the waiting room of a temporary channel, if it has one.
+func (d Discord) removeWaitingRoom(ctx context.Context, s *dgo.Session, channel TemporaryChannel) error {
+	if channel.WaitingRoomID == "" {
+		return nil
+	}
+
+	if _, err := s.ChannelDelete(channel.WaitingRoomID); err != nil {
+		return fmt.Errorf("unable to delete waiting room: %w", err)
+	}
+	return d.forgetWaitingRoom(ctx, channel.GuildID, channel.WaitingRoomID, channel.ID)
+}
+
+// forgetWaitingRoom removes a waiting room from storage and cache and tells other instances.
+// It does not touch the Discord channel.
+func (d Discord) forgetWaitingRoom(ctx context.Context, guildID, channelID, temporaryChannelID string) error {
+	d.cache.removeWaitingRoom(guildID, channelID)
+	err := d.db.setTemporaryChannelWaitingRoom(ctx, temporaryChannelID, "")
+	if err != nil && !errors.Is(err, apperrors.ErrNotFound) {
+		return fmt.Errorf("unable to remove waiting room of temporary channel (id=%v): %w", temporaryChannelID, err)
+	}
+	d.publishChange(changeWaitingRoomChanged, guildID, channelID)
+	return nil
+}
+
+// knock asks the owner of a temporary channel whether to let in a member who joined its waiting room.
+func (d Discord) knock(s *dgo.Session, e *dgo.VoiceState, temporaryChannelID string) error {
+	channel, err := d.db.temporaryChannel(context.Background(), temporaryChannelID)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get temporary channel: %w", err)
+	}
+
+	if e.UserID == channel.OwnerID {
+		// Owners do not need to ask.
+		if err := s.GuildMemberMove(e.GuildID, e.UserID, &channel.ID); err != nil {
+			return fmt.Errorf("unable to move owner out of waiting room: %w", err)
+		}
+		return nil
+	}
+
+	message := &dgo.MessageSend{
+		Content: fmt.Sprintf("<@%v>, <@%v> is waiting to join.", channel.OwnerID, e.UserID),
+		Components: []dgo.MessageComponent{
+			dgo.ActionsRow{Components: []dgo.MessageComponent{
+				dgo.Button{Label: "Accept", Style: dgo.SuccessButton, CustomID: customID(knockCustomID, "accept", e.UserID)},
+				dgo.Button{Label: "Deny", Style: dgo.DangerButton, CustomID: customID(knockCustomID, "deny", e.UserID)},
+			}},
+		},
+		AllowedMentions: &dgo.MessageAllowedMentions{Users: []string{channel.OwnerID}},
+	}
+	if channel.OwnerID == "" {
+		// Only the owner may answer, the buttons work for whoever claims the channel.
+		message.Content = fmt.Sprintf("<@%v> is waiting to join. The channel has no owner, someone in it has to take it over with `/tempvoice claim` before answering.", e.UserID)
+		message.AllowedMentions = &dgo.MessageAllowedMentions{}
+	}
+	if _, err := s.ChannelMessageSendComplex(channel.ID, message); err != nil {
+		return fmt.Errorf("unable to ask owner to let member in: %w", err)
+	}
+	return nil
+}
+
+// handleKnock handles the Accept and Deny buttons posted by knock, the last part of their custom ID is the member.
+func (d Discord) handleKnock(c *interactionContext) error {
+	if len(c.args) != 2 {
+		return errNoHandler
+	}
+	userID := c.args[1]
+
+	channel, err := d.panelChannel(c)
+	if err != nil {
+		return err
+	}
+	waiting := false
+	if state, err := c.s.State.VoiceState(channel.GuildID, userID); err == nil && channel.WaitingRoomID != "" {
+		waiting = state.ChannelID == channel.WaitingRoomID
+	}
+
+	switch c.args[0] {
+	case "accept":
+		if err := updateOverwrite(c.s, channel.ID, userID, dgo.PermissionOverwriteTypeMember, overwriteChange{allow: ownerPermissions}); err != nil {
+			return newCommandError("Unable to change channel permissions").WithErr(err)
+		}
+		if waiting {
+			if err := c.s.GuildMemberMove(channel.GuildID, userID, &channel.ID); err != nil {
+				return newCommandError("Let the user in but was unable to move them").WithErr(err)
+			}
+		}
+		answerKnock(c, fmt.Sprintf("<@%v> was let in.", userID))
+		return c.text(fmt.Sprintf("Let <@%v> in.", userID))
+	case "deny":
+		if waiting {
+			if err := c.s.GuildMemberMove(channel.GuildID, userID, nil); err != nil {
+				return newCommandError("Unable to disconnect the user from the waiting room").WithErr(err)
+			}
+		}
+		answerKnock(c, fmt.Sprintf("<@%v> was not let in.", userID))
+		return c.text(fmt.Sprintf("Did not let <@%v> in.", userID))
+	}
+	return errNoHandler
+}
+
+// answerKnock replaces the message with the buttons of a knock by content, so that it cannot be answered twice.
+func answerKnock(c *interactionContext, content string) {
+	components := []dgo.MessageComponent{}
+	_, err := c.s.ChannelMessageEditComplex(&dgo.MessageEdit{
+		ID:              c.i.Message.ID,
+		Channel:         c.i.ChannelID,
+		Content:         &content,
+		Components:      &components,
+		AllowedMentions: &dgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		slog.Warn("Unable to update knock message", "channel", c.i.ChannelID, "error", err)
+	}
+}
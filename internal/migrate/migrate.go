@@ -0,0 +1,219 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed postgres/*.sql
+var postgresFS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+var (
+	ErrNoDownMigration = errors.New("migration has no down script")
+
+	fileRegexp = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	driver     driver
+	migrations []Migration
+}
+
+// driver implements the database specific parts of migrating.
+type driver interface {
+	// session runs fn with exclusive access to the migrations of the database.
+	// The version table is created if it does not exist yet.
+	session(ctx context.Context, fn func(s session) error) error
+}
+
+type session interface {
+	appliedVersions(ctx context.Context) (map[int64]time.Time, error)
+
+	// apply runs the up script of m and records it as applied in one transaction.
+	apply(ctx context.Context, m Migration) error
+
+	// revert runs the down script of m and removes its record in one transaction.
+	revert(ctx context.Context, m Migration) error
+}
+
+// MakePostgres returns a Migrator for the Postgres migrations embedded in the binary.
+func MakePostgres(pool *pgxpool.Pool) (Migrator, error) {
+	return makeMigrator(postgresFS, "postgres", postgresDriver{pool: pool})
+}
+
+// MakeSQLite returns a Migrator for the SQLite migrations embedded in the binary.
+func MakeSQLite(db *sql.DB) (Migrator, error) {
+	return makeMigrator(sqliteFS, "sqlite", sqliteDriver{db: db})
+}
+
+func makeMigrator(fsys fs.FS, dir string, driver driver) (Migrator, error) {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return Migrator{}, err
+	}
+	migrations, err := Load(sub)
+	if err != nil {
+		return Migrator{}, err
+	}
+
+	return Migrator{
+		driver:     driver,
+		migrations: migrations,
+	}, nil
+}
+
+// Load reads all migrations from the root of fsys. Files must be named
+// <version>_<name>.up.sql or <version>_<name>.down.sql.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("malformatted migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformatted migration version %q: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration %q: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %v is used by %q and %q", version, m.Name, match[2])
+		}
+
+		switch match[3] {
+		case "up":
+			m.Up = string(content)
+		case "down":
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %v_%v has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations in order.
+func (m Migrator) Up(ctx context.Context) error {
+	return m.driver.session(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			slog.Info("Applying migration", "version", migration.Version, "name", migration.Name)
+			if err := s.apply(ctx, migration); err != nil {
+				return fmt.Errorf("unable to apply migration %v_%v: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the given number of most recently applied migrations.
+func (m Migrator) Down(ctx context.Context, steps int) error {
+	return m.driver.session(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("unable to revert migration %v_%v: %w", migration.Version, migration.Name, ErrNoDownMigration)
+			}
+
+			slog.Info("Reverting migration", "version", migration.Version, "name", migration.Name)
+			if err := s.revert(ctx, migration); err != nil {
+				return fmt.Errorf("unable to revert migration %v_%v: %w", migration.Version, migration.Name, err)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Status reports every known migration and when it was applied, if at all.
+func (m Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.driver.session(ctx, func(s session) error {
+		applied, err := s.appliedVersions(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey is the Postgres advisory lock key held while migrating, so that
+// replicas starting at the same time apply migrations one after another.
+const lockKey = 7_315_402_861
+
+type postgresDriver struct {
+	pool *pgxpool.Pool
+}
+
+type postgresSession struct {
+	conn *pgx.Conn
+}
+
+// session runs fn on a dedicated connection while holding the migration advisory lock.
+func (d postgresDriver) session(ctx context.Context, fn func(s session) error) error {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("unable to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context, the lock must be released even if ctx was cancelled.
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			slog.Warn("Unable to release migration lock", "error", err)
+		}
+	}()
+
+	const sql = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT      PRIMARY KEY,
+		name       TEXT        NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)
+	`
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("unable to create version table: %w", err)
+	}
+
+	return fn(postgresSession{conn: conn.Conn()})
+}
+
+func (s postgresSession) appliedVersions(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := s.conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]time.Time)
+	var (
+		version   int64
+		appliedAt time.Time
+	)
+	_, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		applied[version] = appliedAt
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (s postgresSession) apply(ctx context.Context, m Migration) error {
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		return err
+	})
+}
+
+func (s postgresSession) revert(ctx context.Context, m Migration) error {
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+		return err
+	})
+}
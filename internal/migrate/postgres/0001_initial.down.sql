@@ -0,0 +1,4 @@
+DROP TABLE discord.groups;
+DROP TABLE discord.temporary_channels;
+DROP TABLE discord.creator_channels;
+DROP SCHEMA discord;
@@ -0,0 +1,22 @@
+CREATE SCHEMA discord;
+
+CREATE TABLE discord.creator_channels (
+	id       BIGINT PRIMARY KEY,
+	guild_id BIGINT NOT NULL
+);
+
+CREATE INDEX creator_channels_guild_id_idx ON discord.creator_channels (guild_id);
+
+CREATE TABLE discord.temporary_channels (
+	id       BIGINT PRIMARY KEY,
+	guild_id BIGINT NOT NULL
+);
+
+CREATE INDEX temporary_channels_guild_id_idx ON discord.temporary_channels (guild_id);
+
+CREATE TABLE discord.groups (
+	id       BIGSERIAL PRIMARY KEY,
+	name     TEXT      NOT NULL,
+	guild_id BIGINT    NOT NULL,
+	UNIQUE (guild_id, name)
+);
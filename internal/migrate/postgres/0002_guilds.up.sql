@@ -0,0 +1,11 @@
+CREATE TABLE discord.guilds (
+	id        BIGINT      PRIMARY KEY,
+	joined_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO discord.guilds (id)
+SELECT guild_id FROM discord.creator_channels
+UNION
+SELECT guild_id FROM discord.temporary_channels
+UNION
+SELECT guild_id FROM discord.groups;
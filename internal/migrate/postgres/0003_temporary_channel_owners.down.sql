@@ -0,0 +1 @@
+ALTER TABLE discord.temporary_channels DROP COLUMN owner_id;
@@ -0,0 +1,2 @@
+-- Channels created before owners were tracked have no owner and can be claimed by anyone inside.
+ALTER TABLE discord.temporary_channels ADD COLUMN owner_id BIGINT;
@@ -0,0 +1,6 @@
+DROP INDEX discord.temporary_channels_creator_id_idx;
+
+ALTER TABLE discord.temporary_channels DROP COLUMN number;
+ALTER TABLE discord.temporary_channels DROP COLUMN creator_id;
+
+ALTER TABLE discord.creator_channels DROP COLUMN name_template;
@@ -0,0 +1,7 @@
+ALTER TABLE discord.creator_channels ADD COLUMN name_template TEXT NOT NULL DEFAULT '{nickname}';
+
+-- Channels created before creators were tracked have no creator and number 0.
+ALTER TABLE discord.temporary_channels ADD COLUMN creator_id BIGINT;
+ALTER TABLE discord.temporary_channels ADD COLUMN number INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX temporary_channels_creator_id_idx ON discord.temporary_channels (creator_id);
@@ -0,0 +1,9 @@
+ALTER TABLE discord.creator_channels
+	DROP COLUMN user_limit,
+	DROP COLUMN bitrate,
+	DROP COLUMN video_quality,
+	DROP COLUMN rtc_region,
+	DROP COLUMN category_id,
+	DROP COLUMN nsfw,
+	DROP COLUMN permissions_channel_id,
+	DROP COLUMN role_ids;
@@ -0,0 +1,10 @@
+-- Unset settings are copied from the creator channel.
+ALTER TABLE discord.creator_channels
+	ADD COLUMN user_limit             INTEGER,
+	ADD COLUMN bitrate                INTEGER,
+	ADD COLUMN video_quality          INTEGER,
+	ADD COLUMN rtc_region             TEXT,
+	ADD COLUMN category_id            BIGINT,
+	ADD COLUMN nsfw                   BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN permissions_channel_id BIGINT,
+	ADD COLUMN role_ids               TEXT    NOT NULL DEFAULT '';
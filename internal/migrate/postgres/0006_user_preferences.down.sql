@@ -0,0 +1 @@
+DROP TABLE discord.user_preferences;
@@ -0,0 +1,13 @@
+CREATE TABLE discord.user_preferences (
+	guild_id           BIGINT  NOT NULL,
+	user_id            BIGINT  NOT NULL,
+	name               TEXT,
+	user_limit         INTEGER,
+	locked             BOOLEAN NOT NULL DEFAULT false,
+	hidden             BOOLEAN NOT NULL DEFAULT false,
+	permitted_user_ids TEXT    NOT NULL DEFAULT '',
+	permitted_role_ids TEXT    NOT NULL DEFAULT '',
+	rejected_user_ids  TEXT    NOT NULL DEFAULT '',
+	opted_out          BOOLEAN NOT NULL DEFAULT false,
+	PRIMARY KEY (guild_id, user_id)
+);
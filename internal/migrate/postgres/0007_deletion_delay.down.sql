@@ -0,0 +1,3 @@
+ALTER TABLE discord.temporary_channels DROP COLUMN delete_at;
+
+ALTER TABLE discord.creator_channels DROP COLUMN delete_delay;
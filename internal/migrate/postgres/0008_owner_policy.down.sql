@@ -0,0 +1 @@
+ALTER TABLE discord.creator_channels DROP COLUMN owner_policy;
@@ -0,0 +1,4 @@
+ALTER TABLE discord.guilds DROP COLUMN limit_action;
+ALTER TABLE discord.guilds DROP COLUMN max_channels;
+ALTER TABLE discord.guilds DROP COLUMN max_owned_channels;
+ALTER TABLE discord.guilds DROP COLUMN create_cooldown;
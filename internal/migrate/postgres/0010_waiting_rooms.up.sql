@@ -0,0 +1,2 @@
+-- Voice channel in which members wait to be let into the temporary channel, if it has one.
+ALTER TABLE discord.temporary_channels ADD COLUMN waiting_room_id BIGINT;
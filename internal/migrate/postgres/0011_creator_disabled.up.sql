@@ -0,0 +1,2 @@
+-- Disabled creator channels do not create temporary channels.
+ALTER TABLE discord.creator_channels ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
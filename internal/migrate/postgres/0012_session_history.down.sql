@@ -0,0 +1,2 @@
+DROP TABLE discord.member_sessions;
+DROP TABLE discord.channel_sessions;
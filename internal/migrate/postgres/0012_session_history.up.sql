@@ -0,0 +1,26 @@
+-- Lifetimes of temporary channels, kept for statistics after the channels are gone.
+CREATE TABLE discord.channel_sessions (
+	channel_id     BIGINT      PRIMARY KEY,
+	guild_id       BIGINT      NOT NULL,
+	creator_id     BIGINT,
+	owner_id       BIGINT,
+	created_at     TIMESTAMPTZ NOT NULL,
+	deleted_at     TIMESTAMPTZ,
+	peak_members   INTEGER     NOT NULL DEFAULT 0,
+	member_seconds BIGINT      NOT NULL DEFAULT 0
+);
+
+CREATE INDEX channel_sessions_guild_id_idx ON discord.channel_sessions (guild_id);
+
+-- Stays of members in temporary channels, left_at is unset while they are still in the channel.
+CREATE TABLE discord.member_sessions (
+	id         BIGSERIAL   PRIMARY KEY,
+	guild_id   BIGINT      NOT NULL,
+	channel_id BIGINT      NOT NULL,
+	user_id    BIGINT      NOT NULL,
+	joined_at  TIMESTAMPTZ NOT NULL,
+	left_at    TIMESTAMPTZ
+);
+
+CREATE INDEX member_sessions_guild_id_idx ON discord.member_sessions (guild_id);
+CREATE INDEX member_sessions_channel_id_idx ON discord.member_sessions (channel_id, user_id);
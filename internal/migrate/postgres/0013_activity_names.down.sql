@@ -0,0 +1,2 @@
+ALTER TABLE discord.temporary_channels DROP COLUMN base_name;
+ALTER TABLE discord.creator_channels DROP COLUMN activity_names;
@@ -0,0 +1,5 @@
+-- Temporary channels of creator channels with activity names are named after the activity of their members.
+ALTER TABLE discord.creator_channels ADD COLUMN activity_names BOOLEAN NOT NULL DEFAULT false;
+
+-- Name to restore once the activity a temporary channel is named after ends, if it is named after one.
+ALTER TABLE discord.temporary_channels ADD COLUMN base_name TEXT;
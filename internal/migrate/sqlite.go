@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type sqliteDriver struct {
+	db *sql.DB
+}
+
+type sqliteSession struct {
+	conn *sql.Conn
+}
+
+// session runs fn on a dedicated connection. SQLite has no advisory locks, concurrent
+// migrators are serialised by its write lock and the primary key of the version table.
+func (d sqliteDriver) session(ctx context.Context, fn func(s session) error) error {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	const sql = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT    NOT NULL,
+		applied_at TEXT    NOT NULL
+	)
+	`
+	if _, err := conn.ExecContext(ctx, sql); err != nil {
+		return fmt.Errorf("unable to create version table: %w", err)
+	}
+
+	return fn(sqliteSession{conn: conn})
+}
+
+func (s sqliteSession) appliedVersions(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := s.conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt string
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("unable to read applied migrations: %w", err)
+		}
+		t, err := time.Parse(time.RFC3339, appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("malformatted time of migration %v: %w", version, err)
+		}
+		applied[version] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (s sqliteSession) apply(ctx context.Context, m Migration) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?1, ?2, ?3)", m.Version, m.Name, time.Now().UTC().Format(time.RFC3339))
+		return err
+	})
+}
+
+func (s sqliteSession) revert(ctx context.Context, m Migration) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?1", m.Version)
+		return err
+	})
+}
+
+func (s sqliteSession) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
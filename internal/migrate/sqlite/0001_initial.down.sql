@@ -0,0 +1,3 @@
+DROP TABLE groups;
+DROP TABLE temporary_channels;
+DROP TABLE creator_channels;
@@ -0,0 +1,20 @@
+CREATE TABLE creator_channels (
+	id       TEXT PRIMARY KEY,
+	guild_id TEXT NOT NULL
+);
+
+CREATE INDEX creator_channels_guild_id_idx ON creator_channels (guild_id);
+
+CREATE TABLE temporary_channels (
+	id       TEXT PRIMARY KEY,
+	guild_id TEXT NOT NULL
+);
+
+CREATE INDEX temporary_channels_guild_id_idx ON temporary_channels (guild_id);
+
+CREATE TABLE groups (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	name     TEXT    NOT NULL,
+	guild_id TEXT    NOT NULL,
+	UNIQUE (guild_id, name)
+);
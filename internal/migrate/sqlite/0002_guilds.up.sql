@@ -0,0 +1,11 @@
+CREATE TABLE guilds (
+	id        TEXT PRIMARY KEY,
+	joined_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))
+);
+
+INSERT INTO guilds (id)
+SELECT guild_id FROM creator_channels
+UNION
+SELECT guild_id FROM temporary_channels
+UNION
+SELECT guild_id FROM groups;
@@ -0,0 +1 @@
+ALTER TABLE temporary_channels DROP COLUMN owner_id;
@@ -0,0 +1,6 @@
+DROP INDEX temporary_channels_creator_id_idx;
+
+ALTER TABLE temporary_channels DROP COLUMN number;
+ALTER TABLE temporary_channels DROP COLUMN creator_id;
+
+ALTER TABLE creator_channels DROP COLUMN name_template;
@@ -0,0 +1,8 @@
+ALTER TABLE creator_channels DROP COLUMN role_ids;
+ALTER TABLE creator_channels DROP COLUMN permissions_channel_id;
+ALTER TABLE creator_channels DROP COLUMN nsfw;
+ALTER TABLE creator_channels DROP COLUMN category_id;
+ALTER TABLE creator_channels DROP COLUMN rtc_region;
+ALTER TABLE creator_channels DROP COLUMN video_quality;
+ALTER TABLE creator_channels DROP COLUMN bitrate;
+ALTER TABLE creator_channels DROP COLUMN user_limit;
@@ -0,0 +1,9 @@
+-- Unset settings are copied from the creator channel.
+ALTER TABLE creator_channels ADD COLUMN user_limit INTEGER;
+ALTER TABLE creator_channels ADD COLUMN bitrate INTEGER;
+ALTER TABLE creator_channels ADD COLUMN video_quality INTEGER;
+ALTER TABLE creator_channels ADD COLUMN rtc_region TEXT;
+ALTER TABLE creator_channels ADD COLUMN category_id TEXT;
+ALTER TABLE creator_channels ADD COLUMN nsfw INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE creator_channels ADD COLUMN permissions_channel_id TEXT;
+ALTER TABLE creator_channels ADD COLUMN role_ids TEXT NOT NULL DEFAULT '';
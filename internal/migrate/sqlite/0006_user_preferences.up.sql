@@ -0,0 +1,13 @@
+CREATE TABLE user_preferences (
+	guild_id           TEXT    NOT NULL,
+	user_id            TEXT    NOT NULL,
+	name               TEXT,
+	user_limit         INTEGER,
+	locked             INTEGER NOT NULL DEFAULT 0,
+	hidden             INTEGER NOT NULL DEFAULT 0,
+	permitted_user_ids TEXT    NOT NULL DEFAULT '',
+	permitted_role_ids TEXT    NOT NULL DEFAULT '',
+	rejected_user_ids  TEXT    NOT NULL DEFAULT '',
+	opted_out          INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (guild_id, user_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE temporary_channels DROP COLUMN delete_at;
+
+ALTER TABLE creator_channels DROP COLUMN delete_delay;
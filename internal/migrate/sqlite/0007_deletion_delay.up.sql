@@ -0,0 +1,5 @@
+-- Seconds an empty temporary channel is kept before it is deleted.
+ALTER TABLE creator_channels ADD COLUMN delete_delay INTEGER NOT NULL DEFAULT 0;
+
+-- Set while an empty temporary channel waits to be deleted.
+ALTER TABLE temporary_channels ADD COLUMN delete_at TIMESTAMP;
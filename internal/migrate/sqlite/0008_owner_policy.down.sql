@@ -0,0 +1 @@
+ALTER TABLE creator_channels DROP COLUMN owner_policy;
@@ -0,0 +1,2 @@
+-- Who becomes the owner of a temporary channel when its owner leaves: longest, random or none.
+ALTER TABLE creator_channels ADD COLUMN owner_policy TEXT NOT NULL DEFAULT 'longest';
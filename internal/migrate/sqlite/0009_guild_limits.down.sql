@@ -0,0 +1,4 @@
+ALTER TABLE guilds DROP COLUMN limit_action;
+ALTER TABLE guilds DROP COLUMN max_channels;
+ALTER TABLE guilds DROP COLUMN max_owned_channels;
+ALTER TABLE guilds DROP COLUMN create_cooldown;
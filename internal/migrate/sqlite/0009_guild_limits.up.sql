@@ -0,0 +1,7 @@
+-- Limits on how members create temporary channels, 0 means no limit.
+ALTER TABLE guilds ADD COLUMN create_cooldown INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE guilds ADD COLUMN max_owned_channels INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE guilds ADD COLUMN max_channels INTEGER NOT NULL DEFAULT 0;
+
+-- What happens to members who hit a limit: move or disconnect.
+ALTER TABLE guilds ADD COLUMN limit_action TEXT NOT NULL DEFAULT 'move';
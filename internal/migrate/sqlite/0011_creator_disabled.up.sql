@@ -0,0 +1,2 @@
+-- Disabled creator channels do not create temporary channels.
+ALTER TABLE creator_channels ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;
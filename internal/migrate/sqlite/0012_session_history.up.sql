@@ -0,0 +1,26 @@
+-- Lifetimes of temporary channels, kept for statistics after the channels are gone.
+CREATE TABLE channel_sessions (
+	channel_id     TEXT      PRIMARY KEY,
+	guild_id       TEXT      NOT NULL,
+	creator_id     TEXT,
+	owner_id       TEXT,
+	created_at     TIMESTAMP NOT NULL,
+	deleted_at     TIMESTAMP,
+	peak_members   INTEGER   NOT NULL DEFAULT 0,
+	member_seconds INTEGER   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX channel_sessions_guild_id_idx ON channel_sessions (guild_id);
+
+-- Stays of members in temporary channels, left_at is unset while they are still in the channel.
+CREATE TABLE member_sessions (
+	id         INTEGER   PRIMARY KEY AUTOINCREMENT,
+	guild_id   TEXT      NOT NULL,
+	channel_id TEXT      NOT NULL,
+	user_id    TEXT      NOT NULL,
+	joined_at  TIMESTAMP NOT NULL,
+	left_at    TIMESTAMP
+);
+
+CREATE INDEX member_sessions_guild_id_idx ON member_sessions (guild_id);
+CREATE INDEX member_sessions_channel_id_idx ON member_sessions (channel_id, user_id);
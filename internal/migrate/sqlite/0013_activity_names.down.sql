@@ -0,0 +1,2 @@
+ALTER TABLE temporary_channels DROP COLUMN base_name;
+ALTER TABLE creator_channels DROP COLUMN activity_names;
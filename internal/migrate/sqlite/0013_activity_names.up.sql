@@ -0,0 +1,5 @@
+-- Temporary channels of creator channels with activity names are named after the activity of their members.
+ALTER TABLE creator_channels ADD COLUMN activity_names INTEGER NOT NULL DEFAULT 0;
+
+-- Name to restore once the activity a temporary channel is named after ends, if it is named after one.
+ALTER TABLE temporary_channels ADD COLUMN base_name TEXT;
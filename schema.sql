@@ -1,7 +0,0 @@
-CREATE TABLE bot.creator_channels(
-	id         BIGINT  PRIMARY KEY
-);
-
-CREATE TABLE bot.temporary_voice_channels(
-	id BIGINT  PRIMARY KEY
-);